@@ -31,3 +31,21 @@ func BenchmarkBoxGetWithValues(b *testing.B) {
 		app.ServeHTTP(nil, r)
 	}
 }
+
+func BenchmarkParamAt(b *testing.B) {
+	app := New()
+	app.Get("/:user/:repo/:branch", func(ctx *Context) error {
+		for i := 0; i < ctx.ParamCount(); i++ {
+			ctx.ParamAt(i)
+		}
+		return nil
+	})
+
+	for i := 0; i < b.N; i++ {
+		r, err := http.NewRequest("GET", "/twanies/weavebox/master", nil)
+		if err != nil {
+			panic(err)
+		}
+		app.ServeHTTP(nil, r)
+	}
+}
@@ -0,0 +1,267 @@
+package weavebox
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Decoder decodes a request body into v.
+type Decoder func(r io.Reader, v interface{}) error
+
+// defaultDecoders are the decoders Bind uses for the media types that have no
+// decoder registered with RegisterDecoder.
+var defaultDecoders = map[string]Decoder{
+	"application/json": func(r io.Reader, v interface{}) error {
+		return json.NewDecoder(r).Decode(v)
+	},
+	"application/xml": func(r io.Reader, v interface{}) error {
+		return xml.NewDecoder(r).Decode(v)
+	},
+	"text/xml": func(r io.Reader, v interface{}) error {
+		return xml.NewDecoder(r).Decode(v)
+	},
+}
+
+// RegisterDecoder registers the Decoder Bind uses for request bodies with the
+// given media type. Decoders registered on a Box only apply to the routes of
+// the Box, decoders of the parent are used for the other media types.
+// 	app.RegisterDecoder("application/msgpack", func(r io.Reader, v interface{}) error {
+// 		return msgpack.NewDecoder(r).Decode(v)
+// 	})
+func (w *Weavebox) RegisterDecoder(mediaType string, dec Decoder) {
+	if w.decoders == nil {
+		w.decoders = map[string]Decoder{}
+	}
+	w.decoders[mediaType] = dec
+}
+
+// decoder returns the Decoder for mediaType, or nil if there is none.
+func (w *Weavebox) decoder(mediaType string) Decoder {
+	for ; w != nil; w = w.parent {
+		if dec, ok := w.decoders[mediaType]; ok {
+			return dec
+		}
+	}
+	return defaultDecoders[mediaType]
+}
+
+// Bind decodes the request body into v with the Decoder registered for the
+// Content-Type of the request. JSON and XML are decoded out of the box. URL
+// encoded and multipart forms are bound to the fields of the struct v points
+// to, see bindForm. If no Decoder matches the Content-Type a 415 HTTPError is
+// returned, a body that fails to decode results in a 400 HTTPError. Like
+// DecodeJSON, the body is limited to MaxBodySize and its read to the deadline
+// of the request context. The bound value is then validated by the
+// StructValidator set with SetValidator, if any.
+// 	user := &User{}
+// 	if err := ctx.Bind(user); err != nil {
+// 		return err
+// 	}
+func (c *Context) Bind(v interface{}) error {
+	if err := c.bindBody(v); err != nil {
+		return err
+	}
+	if val := c.weavebox.structValidator(); val != nil {
+		return val.ValidateStruct(v)
+	}
+	return nil
+}
+
+// bindBody decodes the request body into v.
+func (c *Context) bindBody(v interface{}) error {
+	contentType := c.request.Header.Get("Content-Type")
+	if contentType == "" {
+		return errUnsupportedMediaType("missing Content-Type")
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return errUnsupportedMediaType(contentType)
+	}
+	dec := c.weavebox.decoder(mediaType)
+	if dec == nil {
+		switch mediaType {
+		case "application/x-www-form-urlencoded", "multipart/form-data":
+			return c.bindForm(mediaType, v)
+		}
+		return errUnsupportedMediaType(mediaType)
+	}
+	if err := c.decodeBody(dec, v); err != nil {
+		if e, ok := err.(*HTTPError); ok {
+			return e
+		}
+		return NewHTTPError(http.StatusBadRequest, "malformed request body: "+err.Error())
+	}
+	return nil
+}
+
+// Validator is implemented by request types that validate themselves after
+// they are bound by BindValidate.
+// 	func (u *User) Validate() error {
+// 		if u.Name == "" {
+// 			return weavebox.NewHTTPError(http.StatusBadRequest, "name is required")
+// 		}
+// 		return nil
+// 	}
+type Validator interface {
+	Validate() error
+}
+
+// BindValidate binds the request body into v like Bind, and then validates v
+// when it implements Validator. The error returned by Validate is returned
+// unchanged, so the ErrorHandler can respond to it.
+// 	user := &User{}
+// 	if err := ctx.BindValidate(user); err != nil {
+// 		return err
+// 	}
+func (c *Context) BindValidate(v interface{}) error {
+	if err := c.Bind(v); err != nil {
+		return err
+	}
+	if val, ok := v.(Validator); ok {
+		return val.Validate()
+	}
+	return nil
+}
+
+func errUnsupportedMediaType(contentType string) error {
+	return NewHTTPError(http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType)+": "+contentType)
+}
+
+// bindForm binds the values of a URL encoded or multipart form to the fields
+// of the struct v points to. A field is bound to the form value named by its
+// weavebox tag, or by its lowercased name when it has no tag. Fields tagged
+// with "-" are skipped. Strings, booleans, numbers and slices of them are
+// supported, as are *multipart.FileHeader and []*multipart.FileHeader fields
+// for the files of multipart forms. Values that fail to convert result in a
+// 400 HTTPError.
+// 	type Signup struct {
+// 		Email  string                `weavebox:"email"`
+// 		Age    int                   `weavebox:"age"`
+// 		Avatar *multipart.FileHeader `weavebox:"avatar"`
+// 	}
+func (c *Context) bindForm(mediaType string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("weavebox: Bind of a form requires a pointer to a struct")
+	}
+	var (
+		values url.Values
+		files  map[string][]*multipart.FileHeader
+	)
+	if mediaType == "multipart/form-data" {
+		if err := c.parseMultipartForm(); err != nil {
+			return err
+		}
+		values, files = c.request.MultipartForm.Value, c.request.MultipartForm.File
+	} else {
+		r := c.request
+		if max := c.weavebox.maxBodySize(); max > 0 {
+			r.Body = http.MaxBytesReader(c.response, r.Body, max)
+		}
+		if err := r.ParseForm(); err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				return NewHTTPError(http.StatusRequestEntityTooLarge)
+			}
+			return NewHTTPError(http.StatusBadRequest, "malformed request body: "+err.Error())
+		}
+		values = r.PostForm
+	}
+
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Tag.Get("weavebox")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fv := rv.Field(i)
+		switch field.Type {
+		case reflect.TypeOf(&multipart.FileHeader{}):
+			if fhs := files[name]; len(fhs) > 0 {
+				fv.Set(reflect.ValueOf(fhs[0]))
+			}
+			continue
+		case reflect.TypeOf([]*multipart.FileHeader{}):
+			if fhs := files[name]; len(fhs) > 0 {
+				fv.Set(reflect.ValueOf(fhs))
+			}
+			continue
+		}
+		vals, ok := values[name]
+		if !ok || len(vals) == 0 {
+			continue
+		}
+		if err := setFormField(fv, vals); err != nil {
+			return NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid value for %s: %s", name, err))
+		}
+	}
+	return nil
+}
+
+// setFormField sets the field to the form values, converted to its type.
+func setFormField(field reflect.Value, vals []string) error {
+	if field.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(field.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setFormValue(slice.Index(i), val); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	return setFormValue(field, vals[0])
+}
+
+// setFormValue sets v to val, converted to the type of v.
+func setFormValue(v reflect.Value, val string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package weavebox
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type bindUser struct {
+	Name string `json:"name" xml:"name"`
+}
+
+func TestContextBind(t *testing.T) {
+	w := New()
+	w.RegisterDecoder("text/plain", func(r io.Reader, v interface{}) error {
+		b, err := ioutil.ReadAll(r)
+		v.(*bindUser).Name = string(b)
+		return err
+	})
+	w.Post("/", func(ctx *Context) error {
+		u := &bindUser{}
+		if err := ctx.Bind(u); err != nil {
+			return err
+		}
+		return ctx.Text(http.StatusOK, u.Name)
+	})
+
+	tests := []struct {
+		contentType, body string
+		code              int
+		response          string
+	}{
+		{"application/json", `{"name":"anthony"}`, http.StatusOK, "anthony"},
+		{"application/json; charset=utf-8", `{"name":"anthony"}`, http.StatusOK, "anthony"},
+		{"application/xml", `<user><name>anthony</name></user>`, http.StatusOK, "anthony"},
+		{"text/plain", `anthony`, http.StatusOK, "anthony"},
+		{"application/json", `{"name":`, http.StatusBadRequest, "malformed request body"},
+		{"application/msgpack", `...`, http.StatusUnsupportedMediaType, "Unsupported Media Type"},
+		{"", `{"name":"anthony"}`, http.StatusUnsupportedMediaType, "Unsupported Media Type"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("POST", "/", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", test.contentType)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != test.code || !strings.Contains(rw.Body.String(), test.response) {
+			t.Errorf("%q: expecting %d %s got %d %s", test.contentType, test.code, test.response, rw.Code, rw.Body.String())
+		}
+	}
+}
+
+func TestBoxRegisterDecoder(t *testing.T) {
+	w := New()
+	api := w.Box("/api")
+	api.RegisterDecoder("application/json", func(r io.Reader, v interface{}) error {
+		v.(*bindUser).Name = "box"
+		return nil
+	})
+	handler := func(ctx *Context) error {
+		u := &bindUser{}
+		if err := ctx.Bind(u); err != nil {
+			return err
+		}
+		return ctx.Text(http.StatusOK, u.Name)
+	}
+	w.Post("/", handler)
+	api.Post("/", handler)
+
+	for route, name := range map[string]string{"/": "anthony", "/api": "box"} {
+		r, _ := http.NewRequest("POST", route, strings.NewReader(`{"name":"anthony"}`))
+		r.Header.Set("Content-Type", "application/json")
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Body.String() != name {
+			t.Errorf("%s: expecting %s got %s", route, name, rw.Body.String())
+		}
+	}
+}
+
+type bindSignup struct {
+	Email  string                `weavebox:"email"`
+	Age    int                   `weavebox:"age"`
+	Tags   []string              `weavebox:"tag"`
+	Admin  bool                  `weavebox:"-"`
+	Avatar *multipart.FileHeader `weavebox:"avatar"`
+	Note   string
+}
+
+func TestContextBindForm(t *testing.T) {
+	w := New()
+	w.Post("/", func(ctx *Context) error {
+		s := &bindSignup{}
+		if err := ctx.Bind(s); err != nil {
+			return err
+		}
+		avatar := ""
+		if s.Avatar != nil {
+			avatar = s.Avatar.Filename
+		}
+		return ctx.Text(http.StatusOK, fmt.Sprintf("%s %d %v %t %s %s", s.Email, s.Age, s.Tags, s.Admin, s.Note, avatar))
+	})
+
+	tests := []struct {
+		body     string
+		code     int
+		response string
+	}{
+		{"email=a%40b.io&age=30&tag=go&tag=web&admin=true&note=hi", http.StatusOK, "a@b.io 30 [go web] false hi "},
+		{"email=a%40b.io", http.StatusOK, "a@b.io 0 [] false  "},
+		{"age=thirty", http.StatusBadRequest, "invalid value for age"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("POST", "/", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != test.code || !strings.Contains(rw.Body.String(), test.response) {
+			t.Errorf("%q: expecting %d %s got %d %s", test.body, test.code, test.response, rw.Code, rw.Body.String())
+		}
+	}
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	mw.WriteField("email", "a@b.io")
+	mw.WriteField("age", "30")
+	fw, _ := mw.CreateFormFile("avatar", "me.png")
+	fw.Write([]byte("png"))
+	mw.Close()
+	r, _ := http.NewRequest("POST", "/", body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if rw.Body.String() != "a@b.io 30 [] false  me.png" {
+		t.Errorf("expecting the multipart form to be bound got %s", rw.Body.String())
+	}
+}
+
+type validatedUser struct {
+	Name string `json:"name"`
+}
+
+func (u *validatedUser) Validate() error {
+	if u.Name == "" {
+		return NewHTTPError(http.StatusBadRequest, "name is required")
+	}
+	return nil
+}
+
+func TestContextBindValidate(t *testing.T) {
+	w := New()
+	w.Post("/", func(ctx *Context) error {
+		u := &validatedUser{}
+		if err := ctx.BindValidate(u); err != nil {
+			return err
+		}
+		return ctx.Text(http.StatusOK, u.Name)
+	})
+	w.Post("/plain", func(ctx *Context) error {
+		u := &bindUser{}
+		if err := ctx.BindValidate(u); err != nil {
+			return err
+		}
+		return ctx.Text(http.StatusOK, u.Name)
+	})
+
+	tests := []struct {
+		route, body string
+		code        int
+		response    string
+	}{
+		{"/", `{"name":"anthony"}`, http.StatusOK, "anthony"},
+		{"/", `{"name":""}`, http.StatusBadRequest, "name is required"},
+		{"/", `{"name":`, http.StatusBadRequest, "malformed request body"},
+		{"/plain", `{"name":""}`, http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("POST", test.route, strings.NewReader(test.body))
+		r.Header.Set("Content-Type", "application/json")
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != test.code || !strings.Contains(rw.Body.String(), test.response) {
+			t.Errorf("%s %s: expecting %d %s got %d %s", test.route, test.body, test.code, test.response, rw.Code, rw.Body.String())
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package weavebox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// BodyBytes reads the request body and returns it. The body is buffered and
+// Request().Body is reset to a fresh reader over the buffered bytes on each
+// call, so it can be read again by other handlers, a reverse proxy or retried
+// requests. Keep in mind that the whole body is held in memory for the
+// lifetime of the request, MaxBodySize caps its size. Larger bodies result in
+// a 413 HTTPError.
+func (c *Context) BodyBytes() ([]byte, error) {
+	if c.body == nil {
+		b, err := c.readBody()
+		if err != nil {
+			return nil, err
+		}
+		c.body = b
+	}
+	r := c.request
+	r.Body = ioutil.NopCloser(bytes.NewReader(c.body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(c.body)), nil
+	}
+	return c.body, nil
+}
+
+// CaptureBody is a middleware that buffers the request body before the
+// handler runs, so the raw bytes and the parsed body are read from the same
+// buffer. Capturing is opt-in, to not hold every body in memory. It is meant
+// for handlers that need the exact bytes sent, like webhooks verifying a
+// signature, and is bound by MaxBodySize.
+// 	app.Post("/webhooks/github", func(ctx *weavebox.Context) error {
+// 		if !validSignature(ctx.RawBody(), ctx.Header("X-Hub-Signature-256")) {
+// 			return weavebox.NewHTTPError(http.StatusUnauthorized)
+// 		}
+// 		event := &PushEvent{}
+// 		if err := ctx.DecodeJSON(event); err != nil {
+// 			return err
+// 		}
+// 		..
+// 	}, weavebox.CaptureBody)
+func CaptureBody(ctx *Context) error {
+	_, err := ctx.BodyBytes()
+	return err
+}
+
+// RawBody returns the request body buffered by CaptureBody or BodyBytes, or
+// nil if the body is not buffered.
+func (c *Context) RawBody() []byte {
+	return c.body
+}
+
+// maxBodySize returns the MaxBodySize of w or its parents.
+func (w *Weavebox) maxBodySize() int64 {
+	for ; w != nil; w = w.parent {
+		if w.MaxBodySize > 0 {
+			return w.MaxBodySize
+		}
+	}
+	return 0
+}
+
+// readBody reads the complete request body, honoring MaxBodySize.
+func (c *Context) readBody() ([]byte, error) {
+	r := c.request
+	if r.Body == nil {
+		return []byte{}, nil
+	}
+	defer r.Body.Close()
+
+	var body io.Reader = r.Body
+	max := c.weavebox.maxBodySize()
+	if max > 0 {
+		if r.ContentLength > max {
+			return nil, NewHTTPError(http.StatusRequestEntityTooLarge)
+		}
+		body = io.LimitReader(r.Body, max+1)
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if max > 0 && int64(len(b)) > max {
+		return nil, NewHTTPError(http.StatusRequestEntityTooLarge)
+	}
+	return b, nil
+}
+
+// decodeBody decodes the request body with dec. The body is limited to
+// MaxBodySize and the read is bounded by the deadline of the request context:
+// the read deadline of the connection is set to it, so a client that stalls
+// the upload does not hold on to the request. A body larger than MaxBodySize
+// results in a 413 HTTPError, a read that timed out in a 408 HTTPError. Other
+// errors are returned as is. A body buffered by BodyBytes is decoded from the
+// buffer.
+func (c *Context) decodeBody(dec Decoder, v interface{}) error {
+	if c.body != nil {
+		return dec(bytes.NewReader(c.body), v)
+	}
+	r := c.request
+	var body io.Reader = r.Body
+	if max := c.weavebox.maxBodySize(); max > 0 {
+		body = http.MaxBytesReader(c.response, r.Body, max)
+	}
+	ctx := r.Context()
+	deadline, ok := ctx.Deadline()
+	if ok {
+		ok = http.NewResponseController(c.response.w).SetReadDeadline(deadline) == nil
+	}
+	err := dec(&contextReader{ctx: ctx, r: body}, v)
+	if err == nil {
+		if ok {
+			// the body is read, lift the deadline for the next request on
+			// the connection.
+			http.NewResponseController(c.response.w).SetReadDeadline(time.Time{})
+		}
+		return nil
+	}
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return NewHTTPError(http.StatusRequestEntityTooLarge)
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return NewHTTPError(http.StatusRequestTimeout)
+	}
+	return err
+}
+
+// contextReader fails reading once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// LimitUpload returns a middleware that rejects requests declaring a body
+// larger than max bytes in their Content-Length with a 413 HTTPError, before
+// the body is read. If max is 0 the MaxBodySize of the box is used.
+//
+// Clients uploading large bodies with "Expect: 100-continue" wait for the
+// server before sending the body. The std HTTP server only answers with
+// "100 Continue" once the body is read, so a rejected upload is never sent.
+// Keep in mind that the ReadTimeout of the server covers reading the whole
+// request, the time the client waits for "100 Continue" and the upload
+// included, it has to be raised for large uploads with Weavebox.ReadTimeout.
+// 	app.Post("/videos", uploadVideo, weavebox.LimitUpload(1<<30))
+func LimitUpload(max int64) Handler {
+	return func(ctx *Context) error {
+		limit := max
+		if limit == 0 {
+			limit = ctx.weavebox.maxBodySize()
+		}
+		if limit > 0 && ctx.request.ContentLength > limit {
+			return NewHTTPError(http.StatusRequestEntityTooLarge)
+		}
+		return nil
+	}
+}
+
+// EachJSONLine streams a newline-delimited JSON request body, invoking fn for
+// each object without buffering the body. Streaming stops at the first error
+// returned by fn, which is returned. A malformed object results in a 400
+// HTTPError naming the line it starts on, a body larger than MaxBodySize in a
+// 413 HTTPError. When the request is canceled the error of its context is
+// returned.
+// 	err := ctx.EachJSONLine(func(raw json.RawMessage) error {
+// 		var rec Record
+// 		if err := json.Unmarshal(raw, &rec); err != nil {
+// 			return err
+// 		}
+// 		return store.Insert(rec)
+// 	})
+func (c *Context) EachJSONLine(fn func(raw json.RawMessage) error) error {
+	r := c.request
+	if r.Body == nil {
+		return nil
+	}
+	defer r.Body.Close()
+
+	var body io.Reader = r.Body
+	if max := c.weavebox.maxBodySize(); max > 0 {
+		body = http.MaxBytesReader(c.response, r.Body, max)
+	}
+	lr := &lineReader{r: body}
+	dec := json.NewDecoder(lr)
+	line := 1
+	for {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		// More skips the whitespace before the next object, the input offset
+		// is where it starts.
+		dec.More()
+		line += lr.newlinesBefore(dec.InputOffset())
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				return NewHTTPError(http.StatusRequestEntityTooLarge)
+			}
+			return NewHTTPError(http.StatusBadRequest, fmt.Sprintf("malformed JSON on line %d: %s", line, err))
+		}
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+}
+
+// lineReader records the offsets of the newlines read from r, until they are
+// counted by newlinesBefore.
+type lineReader struct {
+	r        io.Reader
+	offset   int64
+	newlines []int64
+}
+
+func (lr *lineReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			lr.newlines = append(lr.newlines, lr.offset+int64(i))
+		}
+	}
+	lr.offset += int64(n)
+	return n, err
+}
+
+// newlinesBefore returns the number of newlines before offset that were not
+// counted yet.
+func (lr *lineReader) newlinesBefore(offset int64) int {
+	n := 0
+	for n < len(lr.newlines) && lr.newlines[n] < offset {
+		n++
+	}
+	lr.newlines = lr.newlines[n:]
+	return n
+}
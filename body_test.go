@@ -0,0 +1,272 @@
+package weavebox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContextBodyBytes(t *testing.T) {
+	w := New()
+	w.Use(func(ctx *Context) error {
+		b, err := ctx.BodyBytes()
+		if err != nil {
+			return err
+		}
+		if string(b) != "hello" {
+			t.Errorf("expecting hello got %s", b)
+		}
+		return nil
+	})
+	w.Post("/", func(ctx *Context) error {
+		b, err := ioutil.ReadAll(ctx.Request().Body)
+		if err != nil {
+			return err
+		}
+		if string(b) != "hello" {
+			t.Errorf("expecting the body to be read again, got %s", b)
+		}
+		body, err := ctx.Request().GetBody()
+		if err != nil {
+			return err
+		}
+		b, _ = ioutil.ReadAll(body)
+		return ctx.Text(http.StatusOK, string(b))
+	})
+	code, body := doRequest(t, "POST", "/", strings.NewReader("hello"), w)
+	isHTTPStatusOK(t, code)
+	if body != "hello" {
+		t.Errorf("expecting hello got %s", body)
+	}
+}
+
+func TestContextBodyBytesMaxBodySize(t *testing.T) {
+	w := New()
+	w.MaxBodySize = 4
+	w.Post("/", func(ctx *Context) error {
+		_, err := ctx.BodyBytes()
+		return err
+	})
+	code, _ := doRequest(t, "POST", "/", strings.NewReader("hello"), w)
+	if code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expecting code 413 got %d", code)
+	}
+	code, _ = doRequest(t, "POST", "/", strings.NewReader("hell"), w)
+	isHTTPStatusOK(t, code)
+}
+
+func TestMaxBodySizeBox(t *testing.T) {
+	w := New()
+	api := w.Box("/api")
+	uploads := w.Box("/uploads")
+	uploads.MaxBodySize = 8
+	w.MaxBodySize = 4
+	readBody := func(ctx *Context) error {
+		_, err := ctx.BodyBytes()
+		return err
+	}
+	api.Post("/", readBody)
+	uploads.Post("/", readBody)
+
+	code, _ := doRequest(t, "POST", "/api", strings.NewReader("hello"), w)
+	if code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expecting the limit of the parent to apply got %d", code)
+	}
+	code, _ = doRequest(t, "POST", "/uploads", strings.NewReader("hello"), w)
+	isHTTPStatusOK(t, code)
+	code, _ = doRequest(t, "POST", "/uploads", strings.NewReader("hello box"), w)
+	if code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expecting the limit of the box to apply got %d", code)
+	}
+}
+
+func TestContextEachJSONLine(t *testing.T) {
+	errStop := errors.New("stop")
+	w := New()
+	w.Post("/import", func(ctx *Context) error {
+		var names []string
+		err := ctx.EachJSONLine(func(raw json.RawMessage) error {
+			var rec struct{ Name string }
+			if err := json.Unmarshal(raw, &rec); err != nil {
+				return err
+			}
+			if rec.Name == "stop" {
+				return errStop
+			}
+			names = append(names, rec.Name)
+			return nil
+		})
+		if err == errStop {
+			return ctx.Text(http.StatusOK, "stopped after "+strings.Join(names, ","))
+		}
+		if err != nil {
+			return err
+		}
+		return ctx.Text(http.StatusOK, strings.Join(names, ","))
+	})
+
+	tests := []struct {
+		body string
+		code int
+		resp string
+	}{
+		{"{\"name\":\"a\"}\n{\"name\":\"b\"}\n\n{\"name\":\"c\"}\n", http.StatusOK, "a,b,c"},
+		{"{\"name\":\"a\"}\n{\"name\":\"stop\"}\n{\"name\":\"c\"}\n", http.StatusOK, "stopped after a"},
+		{"{\"name\":\"a\"}\n{\"name\":\n", http.StatusBadRequest, "malformed JSON on line 2"},
+		{"{\"name\":\"a\"}\n\n{\"name\":\"b\"}\n\n\n{\"name\" 1}\n", http.StatusBadRequest, "malformed JSON on line 6"},
+		{"{\"name\":\n\"a\"}\n{\"name\":\"b\",}\n", http.StatusBadRequest, "malformed JSON on line 3"},
+		{"", http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		code, body := doRequest(t, "POST", "/import", strings.NewReader(test.body), w)
+		if code != test.code || !strings.HasPrefix(body, test.resp) {
+			t.Errorf("%q: expecting %d %s got %d %s", test.body, test.code, test.resp, code, body)
+		}
+	}
+
+	w.MaxBodySize = 20
+	code, _ := doRequest(t, "POST", "/import", strings.NewReader(strings.Repeat("{\"name\":\"a\"}\n", 5)), w)
+	if code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expecting code 413 got %d", code)
+	}
+}
+
+func TestContextEachJSONLineCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r, _ := http.NewRequest("POST", "/", strings.NewReader("{}\n{}\n"))
+	r = r.WithContext(ctx)
+	err := NewTestContext(httptest.NewRecorder(), r).EachJSONLine(func(json.RawMessage) error {
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("expecting context.Canceled got %v", err)
+	}
+}
+
+// bodyReadRecorder records whether the request body was read.
+type bodyReadRecorder struct {
+	read bool
+}
+
+func (b *bodyReadRecorder) Read(p []byte) (int, error) {
+	b.read = true
+	return 0, errors.New("body should not be read")
+}
+
+func TestLimitUpload(t *testing.T) {
+	w := New()
+	w.MaxBodySize = 10
+	w.Post("/default", noopHandler, LimitUpload(0))
+	w.Post("/large", noopHandler, LimitUpload(100))
+
+	for route, expected := range map[string]int{
+		"/default": http.StatusRequestEntityTooLarge,
+		"/large":   http.StatusOK,
+	} {
+		body := &bodyReadRecorder{}
+		r, _ := http.NewRequest("POST", route, body)
+		r.ContentLength = 50
+		r.Header.Set("Expect", "100-continue")
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != expected {
+			t.Errorf("%s: expecting code %d got %d", route, expected, rw.Code)
+		}
+		if body.read {
+			t.Errorf("%s: expecting the body not to be read", route)
+		}
+	}
+}
+
+func TestDecodeJSONMaxBodySize(t *testing.T) {
+	w := New()
+	w.MaxBodySize = 8
+	w.Post("/", func(ctx *Context) error {
+		var v map[string]string
+		return ctx.DecodeJSON(&v)
+	})
+	code, _ := doRequest(t, "POST", "/", strings.NewReader(`{"name": "anthony"}`), w)
+	if code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expecting code 413 got %d", code)
+	}
+}
+
+func TestBindStalledBody(t *testing.T) {
+	w := New()
+	w.Post("/", func(ctx *Context) error {
+		reqCtx, cancel := context.WithTimeout(ctx.Request().Context(), 50*time.Millisecond)
+		defer cancel()
+		ctx.request = ctx.request.WithContext(reqCtx)
+		var v map[string]string
+		return ctx.Bind(&v)
+	})
+	srv := httptest.NewServer(w)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Type: application/json\r\nContent-Length: 100\r\n\r\n{\"name\":")
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("expecting the stalled read to be aborted: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("expecting code 408 got %d", res.StatusCode)
+	}
+}
+
+func TestCaptureBody(t *testing.T) {
+	const payload = `{"ref":"refs/heads/master"}`
+	w := New()
+	w.Post("/webhook", func(ctx *Context) error {
+		if string(ctx.RawBody()) != payload {
+			t.Errorf("expecting the raw body %s got %s", payload, ctx.RawBody())
+		}
+		event := struct{ Ref string }{}
+		if err := ctx.DecodeJSON(&event); err != nil {
+			return err
+		}
+		if err := ctx.Bind(&event); err != nil {
+			return err
+		}
+		return ctx.Text(http.StatusOK, event.Ref)
+	}, CaptureBody)
+	w.Post("/uncaptured", func(ctx *Context) error {
+		if ctx.RawBody() != nil {
+			t.Error("expecting no raw body without CaptureBody")
+		}
+		return nil
+	})
+
+	r, _ := http.NewRequest("POST", "/webhook", strings.NewReader(payload))
+	r.Header.Set("Content-Type", "application/json")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Body.String() != "refs/heads/master" {
+		t.Errorf("expecting refs/heads/master got %s", rw.Body.String())
+	}
+	code, _ := doRequest(t, "POST", "/uncaptured", strings.NewReader(payload), w)
+	isHTTPStatusOK(t, code)
+
+	w.MaxBodySize = 8
+	code, _ = doRequest(t, "POST", "/webhook", strings.NewReader(payload), w)
+	if code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expecting code 413 got %d", code)
+	}
+}
@@ -0,0 +1,83 @@
+package weavebox
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SetCacheControl sets the Cache-Control header of the response, allowing
+// caches to store the response for maxAge. A public response can be stored by
+// shared caches, a private response only by the cache of the client.
+// 	ctx.SetCacheControl(5*time.Minute, true) => "public, max-age=300"
+func (c *Context) SetCacheControl(maxAge time.Duration, public bool) {
+	c.Response().Header().Set("Cache-Control", cacheControl(maxAge, public))
+}
+
+// CacheFor returns a route middleware that allows the responses of the route
+// to be cached by clients and shared caches for d, declaring the caching
+// policy where the route is registered. The Cache-Control header is set
+// before the handler runs, which can still override it.
+// 	app.Get("/countries", listCountries, weavebox.CacheFor(24*time.Hour))
+func CacheFor(d time.Duration) Handler {
+	return func(ctx *Context) error {
+		ctx.SetCacheControl(d, true)
+		return nil
+	}
+}
+
+// SetLastModified sets the Last-Modified header of the response to t, in the
+// HTTP time format.
+func (c *Context) SetLastModified(t time.Time) {
+	c.Response().Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+}
+
+func cacheControl(maxAge time.Duration, public bool) string {
+	visibility := "private"
+	if public {
+		visibility = "public"
+	}
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	return fmt.Sprintf("%s, max-age=%d", visibility, int(maxAge.Seconds()))
+}
+
+// IfMatch reports whether the If-Match precondition of the request holds for
+// the current ETag of the resource. It holds when the request has no If-Match
+// header, when the header is "*" and the resource exists (currentETag is not
+// empty), or when one of the listed ETags strongly matches currentETag.
+// 	if !ctx.IfMatch(doc.ETag()) {
+// 		return ctx.PreconditionFailed()
+// 	}
+func (c *Context) IfMatch(currentETag string) bool {
+	header := strings.TrimSpace(c.request.Header.Get("If-Match"))
+	if header == "" {
+		return true
+	}
+	if currentETag == "" {
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+	if !strings.HasPrefix(currentETag, `"`) && !strings.HasPrefix(currentETag, "W/") {
+		currentETag = `"` + currentETag + `"`
+	}
+	if strings.HasPrefix(currentETag, "W/") {
+		return false
+	}
+	for _, etag := range strings.Split(header, ",") {
+		if strings.TrimSpace(etag) == currentETag {
+			return true
+		}
+	}
+	return false
+}
+
+// PreconditionFailed returns a 412 HTTPError, to be returned by a handler
+// when a precondition like If-Match does not hold.
+func (c *Context) PreconditionFailed() error {
+	return NewHTTPError(http.StatusPreconditionFailed)
+}
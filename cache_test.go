@@ -0,0 +1,109 @@
+package weavebox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContextCacheHeaders(t *testing.T) {
+	modified := time.Date(2015, time.October, 21, 7, 28, 0, 0, time.FixedZone("PDT", -7*3600))
+	w := New()
+	w.Get("/public", func(ctx *Context) error {
+		ctx.SetCacheControl(5*time.Minute, true)
+		ctx.SetLastModified(modified)
+		return nil
+	})
+	w.Get("/private", func(ctx *Context) error {
+		ctx.SetCacheControl(time.Hour, false)
+		return nil
+	})
+
+	r, _ := http.NewRequest("GET", "/public", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if cc := rw.Header().Get("Cache-Control"); cc != "public, max-age=300" {
+		t.Errorf("expecting public, max-age=300 got %s", cc)
+	}
+	if lm := rw.Header().Get("Last-Modified"); lm != "Wed, 21 Oct 2015 14:28:00 GMT" {
+		t.Errorf("expecting Wed, 21 Oct 2015 14:28:00 GMT got %s", lm)
+	}
+
+	r, _ = http.NewRequest("GET", "/private", nil)
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if cc := rw.Header().Get("Cache-Control"); cc != "private, max-age=3600" {
+		t.Errorf("expecting private, max-age=3600 got %s", cc)
+	}
+}
+
+func TestContextIfMatch(t *testing.T) {
+	tests := []struct {
+		ifMatch, etag string
+		match         bool
+	}{
+		{"", `"v1"`, true},
+		{"", "", true},
+		{`"v1"`, `"v1"`, true},
+		{`"v1"`, "v1", true},
+		{`"v0", "v1"`, `"v1"`, true},
+		{`"v0"`, `"v1"`, false},
+		{`W/"v1"`, `"v1"`, false},
+		{`"v1"`, `W/"v1"`, false},
+		{"*", `"v1"`, true},
+		{"*", "", false},
+		{`"v1"`, "", false},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("PUT", "/", nil)
+		if test.ifMatch != "" {
+			r.Header.Set("If-Match", test.ifMatch)
+		}
+		ctx := NewTestContext(httptest.NewRecorder(), r)
+		if match := ctx.IfMatch(test.etag); match != test.match {
+			t.Errorf("If-Match %s with ETag %s: expecting %v got %v", test.ifMatch, test.etag, test.match, match)
+		}
+	}
+}
+
+func TestContextPreconditionFailed(t *testing.T) {
+	w := New()
+	w.Put("/docs/:id", func(ctx *Context) error {
+		if !ctx.IfMatch(`"v2"`) {
+			return ctx.PreconditionFailed()
+		}
+		return nil
+	})
+	r, _ := http.NewRequest("PUT", "/docs/1", nil)
+	r.Header.Set("If-Match", `"v1"`)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusPreconditionFailed {
+		t.Errorf("expecting code 412 got %d", rw.Code)
+	}
+}
+
+func TestCacheFor(t *testing.T) {
+	w := New()
+	w.Get("/countries", noopHandler, CacheFor(24*time.Hour))
+	w.Get("/override", func(ctx *Context) error {
+		ctx.SetCacheControl(time.Minute, false)
+		return nil
+	}, CacheFor(time.Hour))
+	w.Get("/uncached", noopHandler)
+
+	for route, expected := range map[string]string{
+		"/countries": "public, max-age=86400",
+		"/override":  "private, max-age=60",
+		"/uncached":  "",
+	} {
+		r, _ := http.NewRequest("GET", route, nil)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		isHTTPStatusOK(t, rw.Code)
+		if cc := rw.Header().Get("Cache-Control"); cc != expected {
+			t.Errorf("%s: expecting Cache-Control %q got %q", route, expected, cc)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package weavebox
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DecompressRequest returns a Handler that transparently decompresses request
+// bodies sent with a gzip or deflate Content-Encoding, so handlers and
+// DecodeJSON read the plain body. Malformed compressed bodies result in a 400.
+// 	app.Use(weavebox.DecompressRequest())
+func DecompressRequest() Handler {
+	return func(ctx *Context) error {
+		r := ctx.Request()
+		var (
+			body io.ReadCloser
+			err  error
+		)
+		switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+		case "gzip", "x-gzip":
+			body, err = gzip.NewReader(r.Body)
+		case "deflate":
+			body, err = zlib.NewReader(r.Body)
+		default:
+			return nil
+		}
+		if err != nil {
+			return NewHTTPError(http.StatusBadRequest, "malformed compressed request body")
+		}
+		r.Body = &decompressReader{ReadCloser: body, body: r.Body}
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+		return nil
+	}
+}
+
+// decompressReader reads from a decompressor and reports corrupt input as a
+// 400 HTTPError.
+type decompressReader struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
+
+func (d *decompressReader) Read(p []byte) (int, error) {
+	n, err := d.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = NewHTTPError(http.StatusBadRequest, "malformed compressed request body")
+	}
+	return n, err
+}
+
+func (d *decompressReader) Close() error {
+	d.ReadCloser.Close()
+	return d.body.Close()
+}
+
+// Compress returns a Handler that compresses the responses with gzip or
+// deflate, in the order of preference of the client's Accept-Encoding header.
+// Gzip is preferred when the client accepts both equally, responses are sent
+// uncompressed if the client accepts neither or prefers identity. Responses
+// that already have a Content-Encoding, like pre-compressed files, and
+// responses without a body are not compressed. The Vary: Accept-Encoding
+// header is always set, so caches store the variants separately.
+// 	app.Use(weavebox.Compress())
+func Compress() Handler {
+	return func(ctx *Context) error {
+		ctx.Response().Header().Add("Vary", "Accept-Encoding")
+		enc := negotiateEncoding(ctx.request)
+		if enc == "" || ctx.request.Method == "HEAD" {
+			return nil
+		}
+		cw := &compressWriter{ResponseWriter: ctx.response.w, encoding: enc}
+		ctx.response.w = cw
+		ctx.response.closer = cw
+		return nil
+	}
+}
+
+// compressedEncodings are the content-codings Compress supports, in the order
+// of preference of the server.
+var compressedEncodings = []string{"gzip", "deflate"}
+
+// negotiateEncoding returns the content-coding the response to r is
+// compressed with, or an empty string if it is sent uncompressed.
+func negotiateEncoding(r *http.Request) string {
+	header := r.Header.Get("Accept-Encoding")
+	if header == "" {
+		return ""
+	}
+	best, bestQ := "", 0.0
+	for _, enc := range compressedEncodings {
+		if q := encodingQuality(header, enc); q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	for _, part := range strings.Split(header, ",") {
+		if name, q := parseQuality(part); name == "identity" && q > bestQ {
+			return ""
+		}
+	}
+	return best
+}
+
+// compressWriter compresses the response body, unless the response has no
+// body, is already encoded or serves byte ranges. The header is written with
+// the first write of the body, so the Content-Type can be sniffed from the
+// uncompressed body.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding  string
+	enc       io.WriteCloser
+	code      int
+	committed bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.code == 0 {
+		cw.code = code
+	}
+}
+
+// commit writes the header, compressing the body if it has one.
+func (cw *compressWriter) commit(p []byte) {
+	cw.committed = true
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(p) > 0 {
+		h.Set("Content-Type", http.DetectContentType(p))
+	}
+	if cw.compressible() {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		if cw.encoding == "gzip" {
+			cw.enc = gzip.NewWriter(cw.ResponseWriter)
+		} else {
+			cw.enc = zlib.NewWriter(cw.ResponseWriter)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.code)
+}
+
+// compressible reports whether the body of the response is compressed. The
+// ranges of partial content responses, and of responses that accept range
+// requests, refer to the uncompressed body and would not match it anymore.
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	switch {
+	case cw.code < http.StatusOK, cw.code == http.StatusNoContent, cw.code == http.StatusNotModified, cw.code == http.StatusPartialContent:
+		return false
+	case h.Get("Content-Encoding") != "", h.Get("Content-Range") != "", h.Get("Accept-Ranges") != "":
+		return false
+	}
+	return true
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.committed {
+		cw.commit(p)
+	}
+	if cw.enc == nil {
+		return cw.ResponseWriter.Write(p)
+	}
+	return cw.enc.Write(p)
+}
+
+// Flush flushes the compressed data written so far to the client.
+func (cw *compressWriter) Flush() {
+	if !cw.committed {
+		cw.commit(nil)
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes the remaining compressed data, or the header if the response
+// has no body.
+func (cw *compressWriter) Close() error {
+	if !cw.committed {
+		// the response has no body, it is sent uncompressed.
+		if cw.code != 0 {
+			cw.ResponseWriter.WriteHeader(cw.code)
+		}
+		return nil
+	}
+	if cw.enc == nil {
+		return nil
+	}
+	return cw.enc.Close()
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header of r accepts the
+// content-coding enc, either by name or by the "*" wildcard.
+func acceptsEncoding(r *http.Request, enc string) bool {
+	return encodingQuality(r.Header.Get("Accept-Encoding"), enc) > 0
+}
+
+// encodingQuality returns the quality the Accept-Encoding header gives to
+// the content-coding enc, either by name or by the "*" wildcard.
+func encodingQuality(header, enc string) float64 {
+	quality := 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, q := parseQuality(part)
+		switch name {
+		case enc:
+			return q
+		case "*":
+			quality = q
+		}
+	}
+	return quality
+}
+
+// parseQuality splits an element of an Accept header like "gzip;q=0.8" into
+// its lowercased value and quality. The quality defaults to 1.
+func parseQuality(s string) (string, float64) {
+	params := strings.Split(s, ";")
+	q := 1.0
+	for _, param := range params[1:] {
+		param = strings.TrimSpace(param)
+		if strings.HasPrefix(param, "q=") {
+			if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+				q = v
+			}
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(params[0])), q
+}
@@ -0,0 +1,148 @@
+package weavebox
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func doEncodedRequest(w *Weavebox, encoding string, body []byte) (int, string) {
+	r, _ := http.NewRequest("POST", "/", bytes.NewReader(body))
+	r.Header.Set("Content-Encoding", encoding)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	return rw.Code, rw.Body.String()
+}
+
+func TestDecompressRequest(t *testing.T) {
+	w := New()
+	w.Use(DecompressRequest())
+	w.Post("/", func(ctx *Context) error {
+		v := map[string]string{}
+		if err := ctx.DecodeJSON(&v); err != nil {
+			return err
+		}
+		return ctx.Text(http.StatusOK, v["name"])
+	})
+
+	gzipped := &bytes.Buffer{}
+	gw := gzip.NewWriter(gzipped)
+	gw.Write([]byte(`{"name":"anthony"}`))
+	gw.Close()
+	code, body := doEncodedRequest(w, "gzip", gzipped.Bytes())
+	isHTTPStatusOK(t, code)
+	if body != "anthony" {
+		t.Errorf("expecting anthony got %s", body)
+	}
+
+	deflated := &bytes.Buffer{}
+	zw := zlib.NewWriter(deflated)
+	zw.Write([]byte(`{"name":"john"}`))
+	zw.Close()
+	code, body = doEncodedRequest(w, "deflate", deflated.Bytes())
+	isHTTPStatusOK(t, code)
+	if body != "john" {
+		t.Errorf("expecting john got %s", body)
+	}
+
+	code, body = doEncodedRequest(w, "gzip", []byte("not gzipped"))
+	if code != http.StatusBadRequest {
+		t.Errorf("expecting code 400 got %d", code)
+	}
+	if !strings.Contains(body, "malformed") {
+		t.Errorf("expecting body: malformed compressed request body got %s", body)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	w := New()
+	w.Use(Compress())
+	w.Get("/", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, strings.Repeat("weavebox ", 100))
+	})
+	w.Get("/encoded", func(ctx *Context) error {
+		ctx.Response().Header().Set("Content-Encoding", "br")
+		return ctx.Text(http.StatusOK, "already compressed")
+	})
+	w.Get("/content", func(ctx *Context) error {
+		return ctx.ServeContent("content.txt", time.Time{}, strings.NewReader(strings.Repeat("x", 2000)))
+	})
+	w.Get("/empty", func(ctx *Context) error {
+		ctx.Response().WriteHeader(http.StatusNoContent)
+		return nil
+	})
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		encoding       string
+		rangeHeader    string
+	}{
+		{"/", "", "", ""},
+		{"/", "gzip", "gzip", ""},
+		{"/", "deflate", "deflate", ""},
+		{"/", "gzip, deflate", "gzip", ""},
+		{"/", "deflate, gzip", "gzip", ""},
+		{"/", "gzip;q=0.5, deflate", "deflate", ""},
+		{"/", "*", "gzip", ""},
+		{"/", "gzip;q=0, *", "deflate", ""},
+		{"/", "br", "", ""},
+		{"/", "gzip;q=0.5, identity", "", ""},
+		{"/", "GZIP", "gzip", ""},
+		{"/encoded", "gzip", "br", ""},
+		{"/empty", "gzip", "", ""},
+		{"/content", "gzip", "", ""},
+		{"/content", "gzip", "", "bytes=0-99"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		if test.acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", test.acceptEncoding)
+		}
+		if test.rangeHeader != "" {
+			r.Header.Set("Range", test.rangeHeader)
+		}
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if enc := rw.Header().Get("Content-Encoding"); enc != test.encoding {
+			t.Errorf("%s %q: expecting Content-Encoding %q got %q", test.path, test.acceptEncoding, test.encoding, enc)
+		}
+		if vary := rw.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("%s %q: expecting Vary: Accept-Encoding got %q", test.path, test.acceptEncoding, vary)
+		}
+
+		var body io.Reader = rw.Body
+		switch test.encoding {
+		case "gzip":
+			body, _ = gzip.NewReader(rw.Body)
+		case "deflate":
+			body, _ = zlib.NewReader(rw.Body)
+		}
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			t.Errorf("%s %q: %v", test.path, test.acceptEncoding, err)
+		}
+		if test.path == "/" && string(b) != strings.Repeat("weavebox ", 100) {
+			t.Errorf("%s %q: expecting the body to be decoded got %q", test.path, test.acceptEncoding, b)
+		}
+		if test.path == "/content" {
+			size := 2000
+			if test.rangeHeader != "" {
+				size = 100
+				if cr := rw.Header().Get("Content-Range"); rw.Code != http.StatusPartialContent || cr != "bytes 0-99/2000" {
+					t.Errorf("%s %q: expecting 206 with Content-Range bytes 0-99/2000 got %d %s", test.path, test.rangeHeader, rw.Code, cr)
+				}
+			}
+			if len(b) != size {
+				t.Errorf("%s %q: expecting %d bytes got %d", test.path, test.rangeHeader, size, len(b))
+			}
+		}
+	}
+}
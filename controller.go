@@ -0,0 +1,106 @@
+package weavebox
+
+import (
+	"path"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// RouteMapper can be implemented by a controller to map method names to routes
+// explicitly, overruling the naming convention used by Controller.
+// 	func (c *UserController) Routes() map[string]string {
+// 		return map[string]string{"GetComment": "/:user/comments/:id"}
+// 	}
+type RouteMapper interface {
+	Routes() map[string]string
+}
+
+var controllerVerbs = []string{"Get", "Post", "Put", "Patch", "Delete", "Head", "Options"}
+
+// Controller registers each method of c with the Handler signature
+// func(*Context) error as a route under prefix. The HTTP method is taken from
+// the prefix of the method name, the remainder of the name is converted into
+// the route. Words become lowercase and are joined by a dash, a trailing
+// By<Name> declares a named parameter.
+// 	Get()             => GET    /prefix
+// 	GetByID()         => GET    /prefix/:id
+// 	PostUsers()       => POST   /prefix/users
+// 	GetUserProfiles() => GET    /prefix/user-profiles
+// 	DeleteUsersByID() => DELETE /prefix/users/:id
+// Methods that do not start with an HTTP method or have another signature are
+// ignored. Routes that can't be expressed by the convention can be declared by
+// implementing the RouteMapper interface.
+func (w *Weavebox) Controller(prefix string, c interface{}) {
+	var routes map[string]string
+	if r, ok := c.(RouteMapper); ok {
+		routes = r.Routes()
+	}
+	v := reflect.ValueOf(c)
+	t := v.Type()
+	for i := 0; i < t.NumMethod(); i++ {
+		name := t.Method(i).Name
+		h, ok := v.Method(i).Interface().(func(*Context) error)
+		if !ok {
+			continue
+		}
+		method, route, ok := controllerRoute(name)
+		if !ok {
+			continue
+		}
+		if r, ok := routes[name]; ok {
+			route = r
+		}
+		w.add(method, path.Join(prefix, route), h)
+	}
+}
+
+// controllerRoute returns the HTTP method and route for the controller method
+// with the given name.
+func controllerRoute(name string) (string, string, bool) {
+	for _, verb := range controllerVerbs {
+		if !strings.HasPrefix(name, verb) {
+			continue
+		}
+		rest := name[len(verb):]
+		if rest != "" && !unicode.IsUpper(rune(rest[0])) {
+			continue
+		}
+		var (
+			words = splitCamelCase(rest)
+			segs  []string
+		)
+		for i, word := range words {
+			if word == "By" && i+1 < len(words) {
+				param := strings.ToLower(strings.Join(words[i+1:], ""))
+				return strings.ToUpper(verb), path.Join("/", strings.Join(segs, "-"), ":"+param), true
+			}
+			segs = append(segs, strings.ToLower(word))
+		}
+		return strings.ToUpper(verb), path.Join("/", strings.Join(segs, "-")), true
+	}
+	return "", "", false
+}
+
+// splitCamelCase splits s into its words, keeping acronyms together.
+// 	"UserProfilesByID" => ["User", "Profiles", "By", "ID"]
+func splitCamelCase(s string) []string {
+	var (
+		words []string
+		runes = []rune(s)
+		start = 0
+	)
+	for i := 1; i < len(runes); i++ {
+		if !unicode.IsUpper(runes[i]) {
+			continue
+		}
+		if !unicode.IsUpper(runes[i-1]) || (i+1 < len(runes) && !unicode.IsUpper(runes[i+1])) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
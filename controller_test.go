@@ -0,0 +1,80 @@
+package weavebox
+
+import (
+	"net/http"
+	"testing"
+)
+
+type userController struct{}
+
+func (c *userController) Get(ctx *Context) error {
+	return ctx.Text(http.StatusOK, "list")
+}
+
+func (c *userController) GetByID(ctx *Context) error {
+	return ctx.Text(http.StatusOK, "user "+ctx.Param("id"))
+}
+
+func (c *userController) PostUserProfiles(ctx *Context) error {
+	return ctx.Text(http.StatusCreated, "profile")
+}
+
+func (c *userController) DeleteComment(ctx *Context) error {
+	return ctx.Text(http.StatusOK, "comment "+ctx.Param("id"))
+}
+
+func (c *userController) Getaway(ctx *Context) error { return nil }
+
+func (c *userController) GetName() string { return "users" }
+
+func (c *userController) Routes() map[string]string {
+	return map[string]string{"DeleteComment": "/:user/comments/:id"}
+}
+
+func TestController(t *testing.T) {
+	w := New()
+	w.Controller("/users", &userController{})
+
+	tests := []struct {
+		method string
+		route  string
+		code   int
+		body   string
+	}{
+		{"GET", "/users", http.StatusOK, "list"},
+		{"GET", "/users/1", http.StatusOK, "user 1"},
+		{"POST", "/users/user-profiles", http.StatusCreated, "profile"},
+		{"DELETE", "/users/1/comments/2", http.StatusOK, "comment 2"},
+	}
+	for _, test := range tests {
+		code, body := doRequest(t, test.method, test.route, nil, w)
+		if code != test.code {
+			t.Errorf("%s %s: expecting code %d got %d", test.method, test.route, test.code, code)
+		}
+		if body != test.body {
+			t.Errorf("%s %s: expecting body %s got %s", test.method, test.route, test.body, body)
+		}
+	}
+}
+
+func TestControllerRoute(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		route  string
+	}{
+		{"Get", "GET", "/"},
+		{"GetByID", "GET", "/:id"},
+		{"PutUsersByUserID", "PUT", "/users/:userid"},
+		{"OptionsHTTPStatus", "OPTIONS", "/http-status"},
+	}
+	for _, test := range tests {
+		method, route, ok := controllerRoute(test.name)
+		if !ok || method != test.method || route != test.route {
+			t.Errorf("%s: expecting %s %s got %s %s", test.name, test.method, test.route, method, route)
+		}
+	}
+	if _, _, ok := controllerRoute("Getaway"); ok {
+		t.Error("expecting Getaway not to be a route")
+	}
+}
@@ -0,0 +1,165 @@
+package weavebox
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCORSMethods and defaultCORSHeaders are allowed in preflight requests
+// when CORSOptions does not list the allowed methods or headers.
+var (
+	defaultCORSMethods = []string{"GET", "HEAD", "POST"}
+	defaultCORSHeaders = []string{"Origin", "Accept", "Content-Type", "X-Requested-With"}
+)
+
+// CORSOptions configures the CORS middleware.
+type CORSOptions struct {
+	// AllowedOrigins lists the origins allowed to make cross-origin requests,
+	// like "https://example.com". "*" allows any origin.
+	AllowedOrigins []string
+
+	// AllowOriginFunc is invoked for origins that are not in AllowedOrigins,
+	// to validate origins that are only known at runtime, like the domains of
+	// tenants stored in a database.
+	AllowOriginFunc func(origin string) bool
+
+	// AllowedMethods lists the methods allowed in cross-origin requests.
+	// Defaults to GET, HEAD and POST.
+	AllowedMethods []string
+
+	// AllowedHeaders lists the request headers allowed in cross-origin
+	// requests. "*" allows any header. Defaults to Origin, Accept,
+	// Content-Type and X-Requested-With.
+	AllowedHeaders []string
+
+	// ExposedHeaders lists the response headers, besides the simple response
+	// headers, that scripts are allowed to read.
+	ExposedHeaders []string
+
+	// AllowCredentials lets the browser expose the response to requests made
+	// with credentials, like cookies. Credentials are only allowed for the
+	// origins listed in AllowedOrigins or allowed by AllowOriginFunc, never
+	// for origins only allowed by "*".
+	AllowCredentials bool
+
+	// MaxAge is the time the browser may cache the result of a preflight
+	// request. Zero leaves it to the browser.
+	MaxAge time.Duration
+}
+
+// CORS returns a middleware that sets the Access-Control headers of
+// cross-origin requests from allowed origins. The origin is reflected in
+// Access-Control-Allow-Origin, unless it is only allowed by "*", in which case
+// "*" is responded without allowing credentials. Preflight requests are
+// answered with 204 No Content, the handlers after the middleware are not
+// invoked. The router answers OPTIONS requests for paths without an OPTIONS
+// route itself, pass the middleware to GlobalOptions as well to answer their
+// preflight requests.
+// 	cors := weavebox.CORS(weavebox.CORSOptions{
+// 		AllowedOrigins: []string{"https://app.example.com"},
+// 		AllowedMethods: []string{"GET", "POST", "DELETE"},
+// 		MaxAge:         time.Hour,
+// 	})
+// 	app.Use(cors)
+// 	app.GlobalOptions(cors)
+func CORS(opts CORSOptions) Handler {
+	methods, headers := opts.AllowedMethods, opts.AllowedHeaders
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	allowMethods := strings.Join(methods, ", ")
+	exposeHeaders := strings.Join(opts.ExposedHeaders, ", ")
+
+	return func(ctx *Context) error {
+		h := ctx.Response().Header()
+		h.Add("Vary", "Origin")
+		origin := ctx.request.Header.Get("Origin")
+		method := ctx.request.Header.Get("Access-Control-Request-Method")
+		if ctx.request.Method == "OPTIONS" && origin != "" && method != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			requested := ctx.request.Header.Get("Access-Control-Request-Headers")
+			if containsFold(methods, method) && allowHeaders(headers, requested) && opts.setOrigin(h, origin) {
+				h.Set("Access-Control-Allow-Methods", allowMethods)
+				if requested != "" {
+					h.Set("Access-Control-Allow-Headers", requested)
+				}
+				if opts.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge/time.Second)))
+				}
+			}
+			ctx.Response().WriteHeader(http.StatusNoContent)
+			return ErrHandled
+		}
+		if origin != "" && opts.setOrigin(h, origin) && exposeHeaders != "" {
+			h.Set("Access-Control-Expose-Headers", exposeHeaders)
+		}
+		return nil
+	}
+}
+
+// setOrigin sets the Access-Control-Allow-Origin and -Credentials headers if
+// origin is allowed, and reports whether it is.
+func (opts CORSOptions) setOrigin(h http.Header, origin string) bool {
+	allowed, wildcard := opts.allowOrigin(origin)
+	if !allowed {
+		return false
+	}
+	if wildcard {
+		// any site could read the responses of its users if credentials
+		// were allowed for any origin.
+		h.Set("Access-Control-Allow-Origin", "*")
+		return true
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+// allowOrigin reports whether origin is allowed, and whether it is only
+// allowed by the "*" wildcard.
+func (opts CORSOptions) allowOrigin(origin string) (allowed, wildcard bool) {
+	for _, o := range opts.AllowedOrigins {
+		if strings.EqualFold(o, origin) {
+			return true, false
+		}
+		if o == "*" {
+			wildcard = true
+		}
+	}
+	if opts.AllowOriginFunc != nil && opts.AllowOriginFunc(origin) {
+		return true, false
+	}
+	return wildcard, wildcard
+}
+
+// allowHeaders reports whether all the headers of the comma separated list
+// requested are allowed.
+func allowHeaders(allowed []string, requested string) bool {
+	if containsFold(allowed, "*") {
+		return true
+	}
+	for _, name := range strings.Split(requested, ",") {
+		if name = strings.TrimSpace(name); name != "" && !containsFold(allowed, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsFold reports whether s is in list, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package weavebox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORSAllowOriginFunc(t *testing.T) {
+	tenants := map[string]bool{"https://acme.example.com": true}
+	w := New()
+	w.Use(CORS(CORSOptions{
+		AllowedOrigins:   []string{"https://example.com"},
+		AllowOriginFunc:  func(origin string) bool { return tenants[origin] },
+		AllowCredentials: true,
+	}))
+	w.Get("/", noopHandler)
+
+	tests := []struct {
+		origin   string
+		expected string
+	}{
+		{"", ""},
+		{"https://example.com", "https://example.com"},
+		{"https://acme.example.com", "https://acme.example.com"},
+		{"https://evil.example.com", ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if origin := rw.Header().Get("Access-Control-Allow-Origin"); origin != test.expected {
+			t.Errorf("%q: expecting Access-Control-Allow-Origin %q got %q", test.origin, test.expected, origin)
+		}
+		credentials := rw.Header().Get("Access-Control-Allow-Credentials")
+		if (test.expected != "") != (credentials == "true") {
+			t.Errorf("%q: unexpected Access-Control-Allow-Credentials %q", test.origin, credentials)
+		}
+	}
+}
+
+func TestCORSWildcard(t *testing.T) {
+	for _, credentials := range []bool{false, true} {
+		w := New()
+		w.Use(CORS(CORSOptions{AllowedOrigins: []string{"https://trusted.com", "*"}, AllowCredentials: credentials}))
+		w.Get("/", noopHandler)
+
+		tests := []struct {
+			origin      string
+			allowOrigin string
+			credentials string
+		}{
+			{"https://example.com", "*", ""},
+			{"https://trusted.com", "https://trusted.com", ""},
+		}
+		if credentials {
+			tests[1].credentials = "true"
+		}
+		for _, test := range tests {
+			r, _ := http.NewRequest("GET", "/", nil)
+			r.Header.Set("Origin", test.origin)
+			rw := httptest.NewRecorder()
+			w.ServeHTTP(rw, r)
+			if origin := rw.Header().Get("Access-Control-Allow-Origin"); origin != test.allowOrigin {
+				t.Errorf("credentials %v %s: expecting Access-Control-Allow-Origin %q got %q", credentials, test.origin, test.allowOrigin, origin)
+			}
+			if c := rw.Header().Get("Access-Control-Allow-Credentials"); c != test.credentials {
+				t.Errorf("credentials %v %s: expecting Access-Control-Allow-Credentials %q got %q", credentials, test.origin, test.credentials, c)
+			}
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	cors := CORS(CORSOptions{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedMethods: []string{"GET", "DELETE"},
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		ExposedHeaders: []string{"X-Total-Count"},
+		MaxAge:         time.Hour,
+	})
+	invoked := false
+	w := New()
+	w.Use(cors)
+	w.GlobalOptions(cors)
+	w.Get("/users", func(ctx *Context) error {
+		ctx.Response().Header().Set("X-Total-Count", "1")
+		return ctx.Text(http.StatusOK, "users")
+	})
+	w.Delete("/users", noopHandler)
+	w.Options("/items", func(ctx *Context) error {
+		invoked = true
+		return nil
+	})
+
+	tests := []struct {
+		path, origin, method, headers string
+		allowed                       bool
+	}{
+		{"/users", "https://example.com", "DELETE", "content-type, authorization", true},
+		{"/users", "https://example.com", "GET", "", true},
+		{"/items", "https://example.com", "DELETE", "", true},
+		{"/users", "https://example.com", "PUT", "", false},
+		{"/users", "https://example.com", "DELETE", "X-Custom", false},
+		{"/users", "https://evil.com", "DELETE", "", false},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("OPTIONS", test.path, nil)
+		r.Header.Set("Origin", test.origin)
+		r.Header.Set("Access-Control-Request-Method", test.method)
+		if test.headers != "" {
+			r.Header.Set("Access-Control-Request-Headers", test.headers)
+		}
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != http.StatusNoContent {
+			t.Errorf("%+v: expecting code 204 got %d", test, rw.Code)
+		}
+		h := rw.Header()
+		if !test.allowed {
+			if h.Get("Access-Control-Allow-Origin") != "" || h.Get("Access-Control-Allow-Methods") != "" {
+				t.Errorf("%+v: expecting the preflight to be rejected got %v", test, h)
+			}
+			continue
+		}
+		if h.Get("Access-Control-Allow-Origin") != test.origin ||
+			h.Get("Access-Control-Allow-Methods") != "GET, DELETE" ||
+			h.Get("Access-Control-Allow-Headers") != test.headers ||
+			h.Get("Access-Control-Max-Age") != "3600" {
+			t.Errorf("%+v: expecting the preflight to be allowed got %v", test, h)
+		}
+	}
+	if invoked {
+		t.Error("expecting the handler not to be invoked for preflight requests")
+	}
+
+	r, _ := http.NewRequest("GET", "/users", nil)
+	r.Header.Set("Origin", "https://example.com")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Body.String() != "users" || rw.Header().Get("Access-Control-Expose-Headers") != "X-Total-Count" {
+		t.Errorf("expecting the exposed headers to be set got %v %s", rw.Header(), rw.Body.String())
+	}
+	if rw.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Error("expecting no preflight headers on the actual request")
+	}
+}
@@ -0,0 +1,41 @@
+package weavebox
+
+import "net/http"
+
+// Handle implements the common decode, do and respond pattern of REST
+// handlers. The JSON request body is decoded into v, unless v is nil, after
+// which fn is invoked. The result of fn is responded as JSON with the status
+// fn returns. If the status is 0, 201 is used for POST requests and 200 for
+// other requests. A malformed body results in a 400 HTTPError, errors of fn
+// are returned as is and end up at the ErrorHandler.
+// 	app.Post("/users", func(ctx *weavebox.Context) error {
+// 		user := &User{}
+// 		return ctx.Handle(user, func() (interface{}, int, error) {
+// 			return user, 0, db.CreateUser(user)
+// 		})
+// 	})
+func (c *Context) Handle(v interface{}, fn func() (interface{}, int, error)) error {
+	if v != nil {
+		if err := c.DecodeJSON(v); err != nil {
+			if e, ok := err.(*HTTPError); ok {
+				return e
+			}
+			return NewHTTPError(http.StatusBadRequest, "malformed JSON request body: "+err.Error())
+		}
+	}
+	result, code, err := fn()
+	if err != nil {
+		return err
+	}
+	if code == 0 {
+		code = http.StatusOK
+		if c.request.Method == "POST" {
+			code = http.StatusCreated
+		}
+	}
+	if code == http.StatusNoContent {
+		c.response.WriteHeader(code)
+		return nil
+	}
+	return c.JSON(code, result)
+}
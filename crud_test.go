@@ -0,0 +1,59 @@
+package weavebox
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestContextHandle(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+	w := New()
+	w.Post("/users", func(ctx *Context) error {
+		u := &user{}
+		return ctx.Handle(u, func() (interface{}, int, error) {
+			if u.Name == "" {
+				return nil, 0, NewHTTPError(http.StatusUnprocessableEntity, "name is required")
+			}
+			return u, 0, nil
+		})
+	})
+	w.Get("/users/:name", func(ctx *Context) error {
+		return ctx.Handle(nil, func() (interface{}, int, error) {
+			if ctx.Param("name") == "error" {
+				return nil, 0, errors.New("oops")
+			}
+			return &user{Name: ctx.Param("name")}, 0, nil
+		})
+	})
+	w.Delete("/users/:name", func(ctx *Context) error {
+		return ctx.Handle(nil, func() (interface{}, int, error) {
+			return nil, http.StatusNoContent, nil
+		})
+	})
+
+	tests := []struct {
+		method, path, body string
+		code               int
+		response           string
+	}{
+		{"POST", "/users", `{"name":"anthony"}`, http.StatusCreated, `{"name":"anthony"}`},
+		{"POST", "/users", `{"name":`, http.StatusBadRequest, "malformed JSON request body"},
+		{"POST", "/users", `{}`, http.StatusUnprocessableEntity, "name is required"},
+		{"GET", "/users/anthony", "", http.StatusOK, `{"name":"anthony"}`},
+		{"GET", "/users/error", "", http.StatusInternalServerError, "oops"},
+		{"DELETE", "/users/anthony", "", http.StatusNoContent, ""},
+	}
+	for _, test := range tests {
+		code, body := doRequest(t, test.method, test.path, strings.NewReader(test.body), w)
+		if code != test.code {
+			t.Errorf("%s %s: expecting code %d got %d", test.method, test.path, test.code, code)
+		}
+		if !strings.Contains(body, test.response) || (test.response == "" && body != "") {
+			t.Errorf("%s %s: expecting body %q got %q", test.method, test.path, test.response, body)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package weavebox
+
+import "strings"
+
+// IsClientDisconnect reports whether err is caused by the client closing the
+// connection while the response was written, like a broken pipe or a
+// connection reset by the peer. Handlers streaming a response can use it to
+// stop quietly.
+// 	if _, err := ctx.Write(chunk); err != nil {
+// 		if weavebox.IsClientDisconnect(err) {
+// 			return nil
+// 		}
+// 		return err
+// 	}
+func IsClientDisconnect(err error) bool {
+	if err == nil {
+		return false
+	}
+	if isConnErrno(err) {
+		return true
+	}
+	// errors of the HTTP/2 server and TLS connections only carry the cause in
+	// their message.
+	msg := err.Error()
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
@@ -0,0 +1,14 @@
+//go:build !plan9
+
+package weavebox
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isConnErrno reports whether err wraps the errno of a broken pipe or a
+// connection reset by the peer.
+func isConnErrno(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
+}
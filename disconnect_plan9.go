@@ -0,0 +1,7 @@
+package weavebox
+
+// isConnErrno reports false, Plan 9 has no errno. The errors of a closed
+// connection are recognized by their message.
+func isConnErrno(err error) bool {
+	return false
+}
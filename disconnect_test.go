@@ -0,0 +1,68 @@
+package weavebox
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestIsClientDisconnect(t *testing.T) {
+	tests := []struct {
+		err        error
+		disconnect bool
+	}{
+		{nil, false},
+		{errors.New("boom"), false},
+		{syscall.EPIPE, true},
+		{&net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}, true},
+		{&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{errors.New("http2: stream closed: write tcp: broken pipe"), true},
+	}
+	for _, test := range tests {
+		if IsClientDisconnect(test.err) != test.disconnect {
+			t.Errorf("%v: expecting disconnect %v", test.err, test.disconnect)
+		}
+	}
+}
+
+// brokenPipeWriter fails all writes like the connection of a client that
+// disconnected.
+type brokenPipeWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (brokenPipeWriter) Write(p []byte) (int, error) {
+	return 0, &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}
+}
+
+func TestClientDisconnect(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := New()
+	w.Output = buf
+	w.EnableAccessLog = true
+	w.SetErrorHandler(func(ctx *Context, err error) {
+		t.Errorf("expecting the ErrorHandler not to be invoked got %v", err)
+	})
+	w.Get("/", func(ctx *Context) error {
+		return ctx.JSON(http.StatusOK, map[string]string{"hello": "world"})
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	w.ServeHTTP(brokenPipeWriter{httptest.NewRecorder()}, r)
+
+	if out := buf.String(); !strings.HasSuffix(out, `200 0 "/"`+"\n") || strings.Count(out, "\n") != 1 {
+		t.Errorf("expecting only the access-log line without error got %s", out)
+	}
+
+	buf.Reset()
+	w.LogLevel = LevelDebug
+	w.ServeHTTP(brokenPipeWriter{httptest.NewRecorder()}, r)
+	if out := buf.String(); !strings.Contains(out, "level=debug msg=\"client disconnected\"") {
+		t.Errorf("expecting the disconnect to be logged at debug level got %s", out)
+	}
+}
@@ -0,0 +1,195 @@
+package weavebox
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+)
+
+// HTTPError is an error that carries the HTTP status code it should be
+// responded with. The default ErrorHandler writes Code as the response status.
+type HTTPError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	// Fields holds the messages of a ValidationError by field name.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// NewHTTPError returns a new HTTPError with the given code. If no message is
+// given the status text of the code is used.
+func NewHTTPError(code int, msg ...string) *HTTPError {
+	e := &HTTPError{Code: code, Message: http.StatusText(code)}
+	if len(msg) > 0 {
+		e.Message = msg[0]
+	}
+	return e
+}
+
+// Error satisfies the error interface
+func (e *HTTPError) Error() string {
+	return e.Message
+}
+
+// ErrHandled can be returned by a Handler to stop the execution of the
+// handler chain when the response is already written. ErrHandled is never
+// passed to the ErrorHandler.
+var ErrHandled = errors.New("weavebox: request handled")
+
+// NegotiateError responds err in the format the client prefers. Clients that
+// accept HTML over JSON, like browsers, get the template rendered by the
+// template engine, other clients a JSON envelope:
+// 	{"error": {"code": 404, "message": "user not found"}}
+// The status and message are those of an HTTPError, other errors are
+// responded as 500 with their message. The template is rendered with the
+// *HTTPError as data. It is meant to be used in an ErrorHandler.
+// 	app.SetErrorHandler(func(ctx *weavebox.Context, err error) {
+// 		ctx.NegotiateError(err, "error.html")
+// 	})
+func (c *Context) NegotiateError(err error, template string) error {
+	e := toHTTPError(err)
+	if template != "" && c.weavebox.renderer() != nil && c.accepts("application/json", "text/html") == "text/html" {
+		c.Response().Header().Set("Content-Type", "text/html; charset=utf-8")
+		c.Response().WriteHeader(e.Code)
+		return c.Render(template, e)
+	}
+	return c.JSON(e.Code, map[string]*HTTPError{"error": e})
+}
+
+// Format is the format errors are responded in.
+type Format int
+
+// The formats errors can be responded in.
+const (
+	FormatText Format = iota
+	FormatJSON
+	FormatHTML
+)
+
+// SetErrorFormat sets a function that chooses the format of the errors
+// responded by the default ErrorHandler and the built-in 404 Not Found and 405
+// Method Not Allowed responses. JSON errors are written as an envelope like in
+// API mode, HTML errors as a minimal page. Custom ErrorHandler, NotFound and
+// MethodNotAllowed handlers are not affected. A Box uses the function of its
+// parent unless it is set on the box.
+// 	app.SetErrorFormat(func(r *http.Request) weavebox.Format {
+// 		if strings.HasPrefix(r.URL.Path, "/api/") {
+// 			return weavebox.FormatJSON
+// 		}
+// 		return weavebox.FormatHTML
+// 	})
+func (w *Weavebox) SetErrorFormat(fn func(r *http.Request) Format) {
+	w.errorFormat = fn
+}
+
+// errorFormatOf returns the Format of the errors of r, as chosen by the
+// function set with SetErrorFormat on w or its parents.
+func (w *Weavebox) errorFormatOf(r *http.Request) Format {
+	for ; w != nil; w = w.parent {
+		if w.errorFormat != nil {
+			return w.errorFormat(r)
+		}
+	}
+	return FormatText
+}
+
+// SetErrorTemplate sets the template rendered by the default ErrorHandler and
+// the built-in 404 Not Found and 405 Method Not Allowed responses for errors
+// with the given status. A template set for a status ending in 00, like 500,
+// is also rendered for the other statuses of its class that have no template
+// of their own. The template is rendered with the *HTTPError as data. If no
+// template engine is set or the template fails to render, the error is
+// written as plain text. A Box uses the templates of its parent unless it
+// sets its own.
+// 	app.SetErrorTemplate(http.StatusNotFound, "errors/404.html")
+// 	app.SetErrorTemplate(http.StatusInternalServerError, "errors/500.html")
+func (w *Weavebox) SetErrorTemplate(status int, name string) {
+	if w.errorTemplates == nil {
+		w.errorTemplates = map[int]string{}
+	}
+	w.errorTemplates[status] = name
+}
+
+// errorTemplate returns the name of the template for errors with the given
+// status, or an empty string if there is none.
+func (w *Weavebox) errorTemplate(status int) string {
+	for ; w != nil; w = w.parent {
+		if name, ok := w.errorTemplates[status]; ok {
+			return name
+		}
+		if name, ok := w.errorTemplates[status/100*100]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// writeErrorPage writes e with the template set with SetErrorTemplate for its
+// status, unless JSON is asked for. It falls back to writing e in the given
+// format.
+func (w *Weavebox) writeErrorPage(rw http.ResponseWriter, format Format, e *HTTPError) {
+	if format != FormatJSON {
+		name, renderer := w.errorTemplate(e.Code), w.renderer()
+		if name != "" && renderer != nil {
+			buf := &bytes.Buffer{}
+			if err := renderer.Render(buf, name, e); err == nil {
+				rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+				rw.WriteHeader(e.Code)
+				buf.WriteTo(rw)
+				return
+			}
+		}
+	}
+	writeError(rw, format, e)
+}
+
+// writeError writes e in the given format.
+func writeError(rw http.ResponseWriter, format Format, e *HTTPError) {
+	switch format {
+	case FormatJSON:
+		writeAPIError(rw, e)
+	case FormatHTML:
+		writeHTMLError(rw, e)
+	default:
+		http.Error(rw, e.Message, e.Code)
+	}
+}
+
+// writeHTMLError writes e as a minimal HTML page.
+func writeHTMLError(rw http.ResponseWriter, e *HTTPError) {
+	title := fmt.Sprintf("%d %s", e.Code, http.StatusText(e.Code))
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(e.Code)
+	fmt.Fprintf(rw, "<!DOCTYPE html>\n<html>\n<head><title>%s</title></head>\n<body>\n<h1>%s</h1>\n<p>%s</p>\n</body>\n</html>\n",
+		title, title, html.EscapeString(e.Message))
+}
+
+// apiErrorHandler is the ErrorHandler of boxes in API mode.
+func apiErrorHandler(ctx *Context, err error) {
+	writeAPIError(ctx.Response(), toHTTPError(err))
+}
+
+// writeAPIError writes e as a JSON envelope.
+func writeAPIError(rw http.ResponseWriter, e *HTTPError) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(e.Code)
+	json.NewEncoder(rw).Encode(map[string]*HTTPError{"error": e})
+}
+
+// toHTTPError returns err if it is an HTTPError, a 422 HTTPError with the
+// messages of the fields of a ValidationError, or a 500 HTTPError with the
+// message of err. The value of a PanicError is not exposed.
+func toHTTPError(err error) *HTTPError {
+	switch e := err.(type) {
+	case *HTTPError:
+		return e
+	case *ValidationError:
+		return &HTTPError{Code: http.StatusUnprocessableEntity, Message: e.Error(), Fields: e.Fields}
+	case *PanicError:
+		return NewHTTPError(http.StatusInternalServerError)
+	}
+	return NewHTTPError(http.StatusInternalServerError, err.Error())
+}
@@ -39,13 +39,16 @@ type datastore struct {
 	name string
 }
 
+// typed context key, avoiding collisions with keys of other packages
+const datastoreKey weavebox.ContextKey = "datastore"
+
 type dbContext struct {
 	context.Context
 	ds *datastore
 }
 
 func (c *dbContext) Value(key interface{}) interface{} {
-	if key == "datastore" {
+	if key == datastoreKey {
 		return c.ds
 	}
 	return c.Context.Value(key)
@@ -76,7 +79,7 @@ func authenticate(ctx *weavebox.Context) error {
 
 // context helper function to stay lean and mean in your handlers
 func datastoreFromContext(ctx context.Context) *datastore {
-	return ctx.Value("datastore").(*datastore)
+	return ctx.Value(datastoreKey).(*datastore)
 }
 
 func greetingHandler(ctx *weavebox.Context) error {
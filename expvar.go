@@ -0,0 +1,50 @@
+package weavebox
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+var (
+	statsOnce sync.Once
+	stats     *expvar.Map
+)
+
+// publishStats publishes the request counters as the "weavebox" expvar. The
+// counters are shared by all the apps in the process that enable expvar.
+func publishStats() *expvar.Map {
+	statsOnce.Do(func() {
+		stats = expvar.NewMap("weavebox")
+	})
+	return stats
+}
+
+// EnableExpvar publishes request counters to expvar and serves all the
+// published variables as JSON on path. The counters are the total number of
+// requests, the number of requests in flight and the number of responses by
+// status class (status_2xx, status_4xx, ...). The route bypasses all
+// middleware.
+// 	app.EnableExpvar("/debug/vars")
+func (w *Weavebox) EnableExpvar(path string) {
+	w.stats = publishStats()
+	w.router.Handler("GET", path, expvar.Handler())
+}
+
+// countRequest updates the request counters when the request is served.
+func (w *Weavebox) countRequest(res *responseWriter) func() {
+	w.stats.Add("in_flight", 1)
+	return func() {
+		rec := recover()
+		if rec != nil {
+			res.status = http.StatusInternalServerError
+		}
+		w.stats.Add("in_flight", -1)
+		w.stats.Add("requests", 1)
+		w.stats.Add(fmt.Sprintf("status_%dxx", res.Status()/100), 1)
+		if rec != nil {
+			panic(rec)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package weavebox
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEnableExpvar(t *testing.T) {
+	w := New()
+	w.EnableExpvar("/debug/vars")
+	w.Get("/ok", func(ctx *Context) error {
+		if n := statsValue("in_flight"); n < 1 {
+			t.Errorf("expecting at least 1 request in flight got %d", n)
+		}
+		return nil
+	})
+	w.Get("/fail", func(ctx *Context) error {
+		return errors.New("oops")
+	})
+
+	requests := statsValue("requests")
+	ok := statsValue("status_2xx")
+	failed := statsValue("status_5xx")
+	for _, route := range []string{"/ok", "/ok", "/fail"} {
+		r, _ := http.NewRequest("GET", route, nil)
+		w.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if n := statsValue("requests") - requests; n != 3 {
+		t.Errorf("expecting 3 requests got %d", n)
+	}
+	if n := statsValue("status_2xx") - ok; n != 2 {
+		t.Errorf("expecting 2 status_2xx got %d", n)
+	}
+	if n := statsValue("status_5xx") - failed; n != 1 {
+		t.Errorf("expecting 1 status_5xx got %d", n)
+	}
+	if n := statsValue("in_flight"); n != 0 {
+		t.Errorf("expecting 0 requests in flight got %d", n)
+	}
+
+	r, _ := http.NewRequest("GET", "/debug/vars", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	var vars struct {
+		Weavebox map[string]int64 `json:"weavebox"`
+	}
+	if err := json.NewDecoder(rw.Body).Decode(&vars); err != nil {
+		t.Fatal(err)
+	}
+	if vars.Weavebox["requests"] < 3 {
+		t.Errorf("expecting the requests counter to be published got %v", vars.Weavebox)
+	}
+}
+
+func statsValue(key string) int64 {
+	if v, ok := publishStats().Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
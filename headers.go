@@ -0,0 +1,44 @@
+package weavebox
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RequireHeaders returns a Handler that rejects requests missing any of the
+// given headers with a 400 HTTPError naming the missing headers.
+// 	api.Use(weavebox.RequireHeaders("API-Version", "Accept"))
+// 	=> 400 missing required headers: API-Version
+func RequireHeaders(names ...string) Handler {
+	return func(ctx *Context) error {
+		var missing []string
+		for _, name := range names {
+			if ctx.Request().Header.Get(name) == "" {
+				missing = append(missing, http.CanonicalHeaderKey(name))
+			}
+		}
+		if len(missing) > 0 {
+			return NewHTTPError(http.StatusBadRequest, "missing required headers: "+strings.Join(missing, ", "))
+		}
+		return nil
+	}
+}
+
+// SetHeaders sets the response headers, replacing their current values.
+// 	ctx.SetHeaders(map[string]string{
+// 		"Cache-Control":   "no-store",
+// 		"X-Frame-Options": "DENY",
+// 	})
+func (c *Context) SetHeaders(headers map[string]string) {
+	h := c.Response().Header()
+	for name, value := range headers {
+		h.Set(name, value)
+	}
+}
+
+// AddHeader adds the value to the response header, keeping its current
+// values, for headers that are sent multiple times like Link.
+// 	ctx.AddHeader("Link", `</app.css>; rel=preload; as=style`)
+func (c *Context) AddHeader(name, value string) {
+	c.Response().Header().Add(name, value)
+}
@@ -0,0 +1,61 @@
+package weavebox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireHeaders(t *testing.T) {
+	w := New()
+	w.Use(RequireHeaders("api-version", "Accept"))
+	w.Get("/", noopHandler)
+
+	tests := []struct {
+		headers map[string]string
+		code    int
+		body    string
+	}{
+		{map[string]string{"API-Version": "1", "Accept": "application/json"}, http.StatusOK, ""},
+		{map[string]string{"Accept": "application/json"}, http.StatusBadRequest, "missing required headers: Api-Version\n"},
+		{nil, http.StatusBadRequest, "missing required headers: Api-Version, Accept\n"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		for k, v := range test.headers {
+			r.Header.Set(k, v)
+		}
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != test.code || rw.Body.String() != test.body {
+			t.Errorf("%v: expecting %d %q got %d %q", test.headers, test.code, test.body, rw.Code, rw.Body.String())
+		}
+	}
+}
+
+func TestContextSetHeaders(t *testing.T) {
+	w := New()
+	w.Get("/", func(ctx *Context) error {
+		ctx.Response().Header().Set("Cache-Control", "public")
+		ctx.SetHeaders(map[string]string{
+			"cache-control":   "no-store",
+			"X-Frame-Options": "DENY",
+		})
+		ctx.AddHeader("Link", "</app.css>; rel=preload")
+		ctx.AddHeader("link", "</app.js>; rel=preload")
+		return nil
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+
+	if cc := rw.Header()["Cache-Control"]; len(cc) != 1 || cc[0] != "no-store" {
+		t.Errorf("expecting Cache-Control to be replaced got %v", cc)
+	}
+	if xfo := rw.Header().Get("X-Frame-Options"); xfo != "DENY" {
+		t.Errorf("expecting X-Frame-Options DENY got %s", xfo)
+	}
+	if links := rw.Header()["Link"]; len(links) != 2 {
+		t.Errorf("expecting 2 Link headers got %v", links)
+	}
+}
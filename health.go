@@ -0,0 +1,81 @@
+package weavebox
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/context"
+)
+
+// healthCheckTimeout bounds the time the health checks are given to report.
+var healthCheckTimeout = 5 * time.Second
+
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// healthReport is the JSON document served on /healthz.
+type healthReport struct {
+	Status string                  `json:"status"`
+	Checks map[string]healthStatus `json:"checks"`
+}
+
+type healthStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// AddHealthCheck registers a named check of a dependency, like pinging a
+// database. The first check registered mounts /healthz, which runs all the
+// checks concurrently and reports their status as JSON. The response is 200
+// if all checks pass and 503 otherwise. Checks that do not return before the
+// context is done fail. The route bypasses all middleware.
+// 	app.AddHealthCheck("database", func(ctx context.Context) error {
+// 		return db.PingContext(ctx)
+// 	})
+func (w *Weavebox) AddHealthCheck(name string, check func(ctx context.Context) error) {
+	root := w.root()
+	if len(root.healthChecks) == 0 {
+		root.router.GET("/healthz", root.serveHealth)
+	}
+	root.healthChecks = append(root.healthChecks, healthCheck{name, check})
+}
+
+func (w *Weavebox) serveHealth(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	results := make([]chan error, len(w.healthChecks))
+	for i, hc := range w.healthChecks {
+		results[i] = make(chan error, 1)
+		go func(check func(context.Context) error, result chan<- error) {
+			result <- check(ctx)
+		}(hc.check, results[i])
+	}
+
+	report := healthReport{Status: "ok", Checks: map[string]healthStatus{}}
+	code := http.StatusOK
+	for i, hc := range w.healthChecks {
+		var err error
+		select {
+		case err = <-results[i]:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		status := healthStatus{Status: "ok"}
+		if err != nil {
+			status = healthStatus{Status: "error", Error: err.Error()}
+			report.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+		}
+		report.Checks[hc.name] = status
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(report)
+}
@@ -0,0 +1,68 @@
+package weavebox
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestAddHealthCheck(t *testing.T) {
+	defer func(d time.Duration) { healthCheckTimeout = d }(healthCheckTimeout)
+	healthCheckTimeout = 50 * time.Millisecond
+
+	w := New()
+	w.Use(func(ctx *Context) error {
+		return errors.New("middleware should not run")
+	})
+	w.AddHealthCheck("database", func(ctx context.Context) error { return nil })
+	w.AddHealthCheck("cache", func(ctx context.Context) error { return nil })
+
+	report := doHealthRequest(t, w, http.StatusOK)
+	if report.Status != "ok" || len(report.Checks) != 2 || report.Checks["cache"].Status != "ok" {
+		t.Errorf("expecting all checks to be ok got %+v", report)
+	}
+
+	w.Box("/api").AddHealthCheck("upstream", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	w.AddHealthCheck("hung", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	start := time.Now()
+	report = doHealthRequest(t, w, http.StatusServiceUnavailable)
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expecting a hung check to time out, took %s", time.Since(start))
+	}
+	if report.Status != "unavailable" {
+		t.Errorf("expecting status unavailable got %s", report.Status)
+	}
+	if s := report.Checks["upstream"]; s.Status != "error" || s.Error != "connection refused" {
+		t.Errorf("expecting upstream to fail got %+v", s)
+	}
+	if s := report.Checks["hung"]; s.Status != "error" {
+		t.Errorf("expecting hung to fail got %+v", s)
+	}
+	if s := report.Checks["database"]; s.Status != "ok" {
+		t.Errorf("expecting database to be ok got %+v", s)
+	}
+}
+
+func doHealthRequest(t *testing.T, w *Weavebox, code int) healthReport {
+	r, _ := http.NewRequest("GET", "/healthz", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != code {
+		t.Errorf("expecting code %d got %d", code, rw.Code)
+	}
+	var report healthReport
+	if err := json.NewDecoder(rw.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
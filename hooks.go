@@ -0,0 +1,54 @@
+package weavebox
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ResponseFunc is invoked after a request is responded with the final status,
+// the size of the body and the time it took to serve the request.
+type ResponseFunc func(ctx *Context, status, size int, d time.Duration)
+
+// OnResponse registers a ResponseFunc that is invoked after each request is
+// served, including requests responded with 404 Not Found, 405 Method Not
+// Allowed and requests that panicked, which are reported with status 500. The
+// route that matched the request is returned by ctx.Route, it is empty for
+// requests that matched no route. The hooks apply to the whole app, even when
+// registered on a Box.
+// 	app.OnResponse(func(ctx *weavebox.Context, status, size int, d time.Duration) {
+// 		metrics.Observe(ctx.Route(), status/100, d)
+// 	})
+func (w *Weavebox) OnResponse(fn ResponseFunc) {
+	root := w.root()
+	root.onResponse = append(root.onResponse, fn)
+}
+
+// notifyResponse returns a function to be deferred by ServeHTTP that invokes
+// the ResponseFuncs once the request is served.
+func (w *Weavebox) notifyResponse(r *http.Request, res *responseWriter, start time.Time) func() {
+	return func() {
+		rec := recover()
+		if rec != nil {
+			res.status = http.StatusInternalServerError
+		}
+		ctx := &Context{
+			Context:  w.context,
+			response: res,
+			request:  r,
+			route:    res.route,
+			weavebox: w,
+		}
+		if ctx.Context == nil {
+			ctx.Context = context.Background()
+		}
+		d := time.Since(start)
+		for _, fn := range w.onResponse {
+			fn(ctx, res.Status(), res.Size(), d)
+		}
+		if rec != nil {
+			panic(rec)
+		}
+	}
+}
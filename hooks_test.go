@@ -0,0 +1,58 @@
+package weavebox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOnResponse(t *testing.T) {
+	type response struct {
+		route  string
+		status int
+		size   int
+	}
+	var got []response
+	w := New()
+	w.Box("/api").OnResponse(func(ctx *Context, status, size int, d time.Duration) {
+		if d <= 0 {
+			t.Error("expecting the duration of the request")
+		}
+		got = append(got, response{ctx.Route(), status, size})
+	})
+	w.Get("/users/:id", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, "hello")
+	})
+	w.Get("/panic", func(ctx *Context) error {
+		panic("boom")
+	})
+
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/users/1"},
+		{"GET", "/missing"},
+		{"POST", "/users/1"},
+		{"GET", "/panic"},
+	} {
+		func() {
+			defer func() { recover() }()
+			r, _ := http.NewRequest(req.method, req.path, nil)
+			w.ServeHTTP(httptest.NewRecorder(), r)
+		}()
+	}
+
+	expected := []response{
+		{"/users/:id", http.StatusOK, 5},
+		{"", http.StatusNotFound, 19},
+		{"", http.StatusMethodNotAllowed, 19},
+		{"/panic", http.StatusInternalServerError, 0},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expecting %d responses got %d", len(expected), len(got))
+	}
+	for i, res := range expected {
+		if got[i] != res {
+			t.Errorf("expecting %+v got %+v", res, got[i])
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package weavebox
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Host returns a Box that only serves requests for the given host. The pattern
+// is either an exact host like "api.example.com", or a wildcard like
+// "*.example.com" that matches any subdomain of example.com. Exact hosts take
+// precedence over wildcards, longer wildcards over shorter ones. Requests for
+// hosts without a match are served by the routes registered on the app.
+//
+// Like a Box, the host inherits the middleware of its parent at the time it is
+// created. Routes of a host are matched against the path only after the host
+// is matched. The same Box is returned for repeated calls with a pattern.
+// 	tenants := app.Host("*.example.com")
+// 	tenants.Get("/", func(ctx *weavebox.Context) error {
+// 		return ctx.Text(http.StatusOK, "hello "+ctx.Subdomain())
+// 	})
+func (w *Weavebox) Host(pattern string) *Box {
+	pattern = strings.ToLower(pattern)
+	root := w.root()
+	for _, b := range root.hosts {
+		if b.host == pattern {
+			return b
+		}
+	}
+	b := w.Box("")
+	b.host = pattern
+	b.router = httprouter.New()
+	b.anyRouter = httprouter.New()
+	b.router.NotFound = http.HandlerFunc(b.serveNotFound)
+	b.router.MethodNotAllowed = http.HandlerFunc(b.serveMethodNotAllowed)
+	root.hosts = append(root.hosts, b)
+	return b
+}
+
+// Subdomain returns the part of the request host matched by the wildcard of
+// the Host pattern the route is registered on. It returns an empty string for
+// routes that are not registered on a wildcard host.
+// 	app.Host("*.example.com") + acme.example.com => ctx.Subdomain() == "acme"
+func (c *Context) Subdomain() string {
+	pattern := c.weavebox.host
+	if !strings.HasPrefix(pattern, "*.") {
+		return ""
+	}
+	return strings.TrimSuffix(hostname(c.request), pattern[1:])
+}
+
+// hostRouter returns the router of the host matching the request, or the
+// router of the app if no host matches.
+func (w *Weavebox) hostRouter(r *http.Request) *httprouter.Router {
+	hosts := w.root().hosts
+	if len(hosts) == 0 {
+		return w.router
+	}
+	var (
+		host  = hostname(r)
+		match *Box
+	)
+	for _, b := range hosts {
+		if b.host == host {
+			return b.router
+		}
+		if strings.HasPrefix(b.host, "*.") && strings.HasSuffix(host, b.host[1:]) && len(host) > len(b.host)-1 {
+			if match == nil || len(b.host) > len(match.host) {
+				match = b
+			}
+		}
+	}
+	if match != nil {
+		return match.router
+	}
+	return w.router
+}
+
+// hostname returns the lowercased request host without the port.
+func hostname(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
@@ -0,0 +1,77 @@
+package weavebox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func doHostRequest(t *testing.T, w *Weavebox, host, route string) (int, string) {
+	r, err := http.NewRequest("GET", route, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Host = host
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	return rw.Code, rw.Body.String()
+}
+
+func TestHost(t *testing.T) {
+	w := New()
+	w.Get("/", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, "app "+ctx.Subdomain())
+	})
+	w.Host("*.example.com").Get("/", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, "tenant "+ctx.Subdomain())
+	})
+	w.Host("api.example.com").Get("/", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, "api")
+	})
+	w.Host("*.eu.example.com").Get("/", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, "eu "+ctx.Subdomain())
+	})
+
+	tests := []struct {
+		host string
+		body string
+	}{
+		{"example.com", "app "},
+		{"acme.example.com:8080", "tenant acme"},
+		{"ACME.example.com", "tenant acme"},
+		{"api.example.com", "api"},
+		{"acme.eu.example.com", "eu acme"},
+	}
+	for _, test := range tests {
+		code, body := doHostRequest(t, w, test.host, "/")
+		isHTTPStatusOK(t, code)
+		if body != test.body {
+			t.Errorf("%s: expecting %s got %s", test.host, test.body, body)
+		}
+	}
+	if code, _ := doHostRequest(t, w, "acme.example.com", "/nope"); code != http.StatusNotFound {
+		t.Errorf("expecting code 404 got %d", code)
+	}
+}
+
+func TestHostMiddleware(t *testing.T) {
+	w := New()
+	w.Use(func(ctx *Context) error {
+		ctx.Response().Header().Set("x-app", "app")
+		return nil
+	})
+	tenant := w.Host("*.example.com")
+	tenant.Get("/", noopHandler)
+	if w.Host("*.example.com") != tenant {
+		t.Error("expecting the same box for the same host pattern")
+	}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Host = "acme.example.com"
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if rw.Header().Get("x-app") != "app" {
+		t.Error("expecting the host to inherit the app middleware")
+	}
+}
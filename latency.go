@@ -0,0 +1,124 @@
+package weavebox
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyWindow is the number of most recent request durations kept per
+// route to compute the percentiles of LatencyStats.
+const latencyWindow = 1024
+
+// LatencyStat holds the latency percentiles of a route, computed over its most
+// recent requests.
+type LatencyStat struct {
+	// Count is the total number of requests served by the route.
+	Count uint64
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+}
+
+// latencyStats holds the durations of the recent requests of each route.
+type latencyStats struct {
+	mu      sync.RWMutex
+	windows map[string]*latencyRing
+}
+
+// latencyRing is a fixed size ring of request durations.
+type latencyRing struct {
+	mu      sync.Mutex
+	samples [latencyWindow]time.Duration
+	count   uint64
+}
+
+// EnableLatencyStats tracks the durations of the last 1024 requests of each
+// route, from which LatencyStats computes their percentiles. Requests that
+// matched no route are not tracked. Like OnResponse it applies to the whole
+// app, even when enabled on a Box.
+// 	app.EnableLatencyStats()
+// 	app.Get("/debug/latency", func(ctx *weavebox.Context) error {
+// 		return ctx.JSON(http.StatusOK, app.LatencyStats())
+// 	})
+func (w *Weavebox) EnableLatencyStats() {
+	root := w.root()
+	if root.latency != nil {
+		return
+	}
+	stats := &latencyStats{windows: map[string]*latencyRing{}}
+	root.latency = stats
+	root.OnResponse(func(ctx *Context, status, size int, d time.Duration) {
+		if ctx.Route() != "" {
+			stats.observe(ctx.Request().Method+" "+ctx.Route(), d)
+		}
+	})
+}
+
+// LatencyStats returns the latency percentiles of each route by its method
+// and route pattern, like "GET /users/:id". It returns nil unless
+// EnableLatencyStats is called.
+func (w *Weavebox) LatencyStats() map[string]LatencyStat {
+	stats := w.root().latency
+	if stats == nil {
+		return nil
+	}
+	stats.mu.RLock()
+	defer stats.mu.RUnlock()
+	m := make(map[string]LatencyStat, len(stats.windows))
+	for route, ring := range stats.windows {
+		m[route] = ring.stat()
+	}
+	return m
+}
+
+// observe records the duration of a request served by route.
+func (s *latencyStats) observe(route string, d time.Duration) {
+	s.mu.RLock()
+	ring, ok := s.windows[route]
+	s.mu.RUnlock()
+	if !ok {
+		s.mu.Lock()
+		if ring, ok = s.windows[route]; !ok {
+			ring = &latencyRing{}
+			s.windows[route] = ring
+		}
+		s.mu.Unlock()
+	}
+	ring.mu.Lock()
+	ring.samples[ring.count%latencyWindow] = d
+	ring.count++
+	ring.mu.Unlock()
+}
+
+// stat computes the percentiles of the durations in the ring.
+func (r *latencyRing) stat() LatencyStat {
+	r.mu.Lock()
+	n := r.count
+	if n > latencyWindow {
+		n = latencyWindow
+	}
+	samples := make([]time.Duration, n)
+	copy(samples, r.samples[:n])
+	st := LatencyStat{Count: r.count}
+	r.mu.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	st.P50 = percentile(samples, 50)
+	st.P95 = percentile(samples, 95)
+	st.P99 = percentile(samples, 99)
+	return st
+}
+
+// percentile returns the p'th percentile of the sorted durations by the
+// nearest-rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,57 @@
+package weavebox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyStats(t *testing.T) {
+	w := New()
+	if w.LatencyStats() != nil {
+		t.Error("expecting no stats before they are enabled")
+	}
+	w.Box("/api").EnableLatencyStats()
+	w.EnableLatencyStats()
+	w.Get("/users/:id", noopHandler)
+
+	for i := 0; i < 3; i++ {
+		doRequest(t, "GET", "/users/1", nil, w)
+	}
+	doRequest(t, "GET", "/missing", nil, w)
+
+	stats := w.LatencyStats()
+	if len(stats) != 1 {
+		t.Fatalf("expecting the stats of 1 route got %v", stats)
+	}
+	st, ok := stats["GET /users/:id"]
+	if !ok || st.Count != 3 {
+		t.Errorf("expecting 3 requests of GET /users/:id got %v", stats)
+	}
+	if st.P50 <= 0 || st.P50 > st.P95 || st.P95 > st.P99 {
+		t.Errorf("expecting ordered percentiles got %+v", st)
+	}
+}
+
+func TestLatencyRing(t *testing.T) {
+	ring := &latencyRing{}
+	for i := 1; i <= 100; i++ {
+		ring.samples[ring.count%latencyWindow] = time.Duration(i) * time.Millisecond
+		ring.count++
+	}
+	st := ring.stat()
+	if st.Count != 100 || st.P50 != 50*time.Millisecond || st.P95 != 95*time.Millisecond || st.P99 != 99*time.Millisecond {
+		t.Errorf("expecting p50 50ms, p95 95ms and p99 99ms got %+v", st)
+	}
+
+	// the oldest durations leave the window.
+	stats := &latencyStats{windows: map[string]*latencyRing{}}
+	for i := 0; i < latencyWindow; i++ {
+		stats.observe("GET /", time.Second)
+	}
+	for i := 0; i < latencyWindow; i++ {
+		stats.observe("GET /", time.Millisecond)
+	}
+	if st := stats.windows["GET /"].stat(); st.Count != 2*latencyWindow || st.P99 != time.Millisecond {
+		t.Errorf("expecting only the recent durations got %+v", st)
+	}
+}
@@ -0,0 +1,131 @@
+package weavebox
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Logger is a leveled logger that logs a message together with key value
+// pairs. Any logger can be used with weavebox if it implements the Logger
+// interface.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+
+	// With returns a child logger that adds keyvals to each line it logs.
+	With(keyvals ...interface{}) Logger
+}
+
+// Level is the minimum level of the lines a Logger returned by NewLevelLogger
+// writes.
+type Level int
+
+// The levels lines are logged at. The zero value is LevelInfo.
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelError
+)
+
+// NewLogger returns a Logger that writes lines in the logfmt format to out.
+// Debug lines are discarded, see NewLevelLogger.
+// 	time=2015-10-21T07:28:00Z level=info msg="user created" route=/users id=42
+func NewLogger(out io.Writer) Logger {
+	return NewLevelLogger(out, LevelInfo)
+}
+
+// NewLevelLogger returns a Logger that writes lines of at least the level min
+// in the logfmt format to out.
+// 	l := weavebox.NewLevelLogger(os.Stderr, weavebox.LevelDebug)
+func NewLevelLogger(out io.Writer, min Level) Logger {
+	return &textLogger{out: out, min: min}
+}
+
+type textLogger struct {
+	out    io.Writer
+	min    Level
+	fields []interface{}
+}
+
+func (l *textLogger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, "debug", msg, keyvals)
+}
+
+func (l *textLogger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, "info", msg, keyvals)
+}
+
+func (l *textLogger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, "error", msg, keyvals)
+}
+
+func (l *textLogger) With(keyvals ...interface{}) Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(fields, l.fields...)
+	return &textLogger{out: l.out, min: l.min, fields: append(fields, keyvals...)}
+}
+
+func (l *textLogger) log(lvl Level, level, msg string, keyvals []interface{}) {
+	if lvl < l.min {
+		return
+	}
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "time=%s level=%s msg=%s", time.Now().Format(time.RFC3339), level, logfmtValue(msg))
+	writeKeyvals(buf, l.fields)
+	writeKeyvals(buf, keyvals)
+	buf.WriteByte('\n')
+	l.out.Write(buf.Bytes())
+}
+
+func writeKeyvals(buf *bytes.Buffer, keyvals []interface{}) {
+	for i := 0; i < len(keyvals); i += 2 {
+		var value interface{} = "MISSING"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		fmt.Fprintf(buf, " %s=%s", keyvals[i], logfmtValue(value))
+	}
+}
+
+func logfmtValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
+
+// logger returns the Logger of the app, or a logger writing to Output at
+// LogLevel if no Logger is set.
+func (w *Weavebox) logger() Logger {
+	if w.Logger != nil {
+		return w.Logger
+	}
+	return NewLevelLogger(w.Output, w.LogLevel)
+}
+
+// Logger returns a logger for the current request. Each line it logs includes
+// the request method, path and matched route, and the fields added by
+// middleware with SetLogger.
+// 	ctx.Logger().Info("user created", "id", user.ID)
+func (c *Context) Logger() Logger {
+	if c.logger == nil {
+		c.logger = c.weavebox.logger().With(
+			"method", c.request.Method,
+			"path", c.request.URL.Path,
+			"route", c.route,
+		)
+	}
+	return c.logger
+}
+
+// SetLogger replaces the logger of the current request. Middleware use it to
+// enrich the request logger with extra fields.
+// 	ctx.SetLogger(ctx.Logger().With("request_id", id))
+func (c *Context) SetLogger(l Logger) {
+	c.logger = l
+}
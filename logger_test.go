@@ -0,0 +1,65 @@
+package weavebox
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewLogger(buf).With("app", "weavebox")
+	l.Info("user created", "id", 42, "name", "john doe")
+	line := buf.String()
+	for _, s := range []string{"level=info", `msg="user created"`, "app=weavebox", "id=42", `name="john doe"`} {
+		if !strings.Contains(line, s) {
+			t.Errorf("expecting line to contain %s got %s", s, line)
+		}
+	}
+}
+
+func TestLevelLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewLogger(buf).With("app", "weavebox")
+	l.Debug("skipped")
+	if buf.Len() != 0 {
+		t.Errorf("expecting debug lines to be discarded by default got %s", buf.String())
+	}
+
+	l = NewLevelLogger(buf, LevelDebug).With("app", "weavebox")
+	l.Debug("cache miss")
+	if !strings.Contains(buf.String(), `level=debug msg="cache miss" app=weavebox`) {
+		t.Errorf("expecting the debug line got %s", buf.String())
+	}
+
+	buf.Reset()
+	l = NewLevelLogger(buf, LevelError)
+	l.Info("skipped")
+	l.Error("failed")
+	if strings.Contains(buf.String(), "skipped") || !strings.Contains(buf.String(), "level=error") {
+		t.Errorf("expecting only the error line got %s", buf.String())
+	}
+}
+
+func TestContextLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := New()
+	w.Output = buf
+	w.Use(func(ctx *Context) error {
+		ctx.SetLogger(ctx.Logger().With("request_id", "abc"))
+		return nil
+	})
+	w.Get("/users/:id", func(ctx *Context) error {
+		ctx.Logger().Error("not found")
+		return nil
+	})
+	code, _ := doRequest(t, "GET", "/users/1", nil, w)
+	isHTTPStatusOK(t, code)
+
+	line := buf.String()
+	for _, s := range []string{"level=error", "method=GET", "path=/users/1", "route=/users/:id", "request_id=abc"} {
+		if !strings.Contains(line, s) {
+			t.Errorf("expecting line to contain %s got %s", s, line)
+		}
+	}
+}
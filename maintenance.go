@@ -0,0 +1,39 @@
+package weavebox
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// maintenanceRetryAfter is the Retry-After header, in seconds, of the
+// responses of the Maintenance middleware.
+const maintenanceRetryAfter = "120"
+
+// Maintenance returns a middleware that responds 503 Service Unavailable with
+// a Retry-After header to all requests while enabled is true, except for the
+// paths in the allowlist and the paths below them. The error is passed to the
+// ErrorHandler, which can render a maintenance page. Flipping enabled, from a
+// signal handler or an admin route, toggles the maintenance mode while the
+// app is running. The health checks are served during maintenance as they
+// bypass all middleware.
+// 	var maintenance atomic.Bool
+// 	app.Use(weavebox.Maintenance(&maintenance, []string{"/status", "/admin"}))
+func Maintenance(enabled *atomic.Bool, allowlist []string) Handler {
+	return func(ctx *Context) error {
+		if !enabled.Load() {
+			return nil
+		}
+		p := ctx.request.URL.Path
+		for _, allowed := range allowlist {
+			if len(allowed) > 1 {
+				allowed = strings.TrimSuffix(allowed, "/")
+			}
+			if p == allowed || strings.HasPrefix(p, allowed+"/") {
+				return nil
+			}
+		}
+		ctx.Response().Header().Set("Retry-After", maintenanceRetryAfter)
+		return NewHTTPError(http.StatusServiceUnavailable, "down for maintenance")
+	}
+}
@@ -0,0 +1,40 @@
+package weavebox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMaintenance(t *testing.T) {
+	var enabled atomic.Bool
+	w := New()
+	w.Use(Maintenance(&enabled, []string{"/status", "/admin/"}))
+	for _, route := range []string{"/", "/status", "/statusx", "/admin", "/admin/users"} {
+		w.Get(route, noopHandler)
+	}
+
+	expect := func(route string, code int) {
+		r, _ := http.NewRequest("GET", route, nil)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != code {
+			t.Errorf("%s: expecting code %d got %d", route, code, rw.Code)
+		}
+		if code == http.StatusServiceUnavailable && rw.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: expecting a Retry-After header", route)
+		}
+	}
+	expect("/", http.StatusOK)
+
+	enabled.Store(true)
+	expect("/", http.StatusServiceUnavailable)
+	expect("/statusx", http.StatusServiceUnavailable)
+	expect("/status", http.StatusOK)
+	expect("/admin", http.StatusOK)
+	expect("/admin/users", http.StatusOK)
+
+	enabled.Store(false)
+	expect("/", http.StatusOK)
+}
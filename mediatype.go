@@ -0,0 +1,67 @@
+package weavebox
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ByContentType returns a Handler that dispatches the request to the handler
+// registered for its Content-Type, so a route can process different request
+// formats with different handlers. The handler of the exact media type is
+// preferred, followed by a "type/*" wildcard, then a "*/*" catch-all. Requests
+// whose Content-Type matches none of them are rejected with a 415 HTTPError.
+// 	app.Post("/graphql", weavebox.ByContentType(map[string]weavebox.Handler{
+// 		"application/json":    graphqlJSON,
+// 		"application/graphql": graphqlQuery,
+// 	}))
+func ByContentType(handlers map[string]Handler) Handler {
+	return func(ctx *Context) error {
+		mediaType, _, err := mime.ParseMediaType(ctx.request.Header.Get("Content-Type"))
+		if err != nil {
+			mediaType = ""
+		}
+		if h, ok := handlers[mediaType]; ok && mediaType != "" {
+			return h(ctx)
+		}
+		if i := strings.IndexByte(mediaType, '/'); i > 0 {
+			if h, ok := handlers[mediaType[:i]+"/*"]; ok {
+				return h(ctx)
+			}
+		}
+		if h, ok := handlers["*/*"]; ok {
+			return h(ctx)
+		}
+		return NewHTTPError(http.StatusUnsupportedMediaType)
+	}
+}
+
+// ByAccept returns a Handler that dispatches the request to the handler
+// registered for the media type that best matches its Accept header, like a
+// JSON and an HTML representation of the same resource. The quality values of
+// the client decide, media types the client prefers equally, or requests
+// without an Accept header, go to the media type that sorts first. If the
+// client accepts none of the media types a 406 HTTPError is returned.
+// 	app.Get("/users/:id", weavebox.ByAccept(map[string]weavebox.Handler{
+// 		"application/json": userJSON,
+// 		"text/html":        userPage,
+// 	}))
+func ByAccept(handlers map[string]Handler) Handler {
+	offers := make([]string, 0, len(handlers))
+	for mediaType := range handlers {
+		offers = append(offers, mediaType)
+	}
+	sort.Strings(offers)
+	return func(ctx *Context) error {
+		ctx.Response().Header().Add("Vary", "Accept")
+		if len(offers) == 0 {
+			return NewHTTPError(http.StatusNotAcceptable)
+		}
+		mediaType := ctx.accepts(offers...)
+		if mediaType == "" {
+			return NewHTTPError(http.StatusNotAcceptable)
+		}
+		return handlers[mediaType](ctx)
+	}
+}
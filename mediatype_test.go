@@ -0,0 +1,94 @@
+package weavebox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func textHandler(text string) Handler {
+	return func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, text)
+	}
+}
+
+func TestByContentType(t *testing.T) {
+	w := New()
+	w.Post("/graphql", ByContentType(map[string]Handler{
+		"application/json":    textHandler("json"),
+		"application/graphql": textHandler("graphql"),
+		"text/*":              textHandler("text"),
+	}))
+	w.Post("/any", ByContentType(map[string]Handler{
+		"application/json": textHandler("json"),
+		"*/*":              textHandler("any"),
+	}))
+
+	tests := []struct {
+		route       string
+		contentType string
+		code        int
+		body        string
+	}{
+		{"/graphql", "application/json; charset=utf-8", http.StatusOK, "json"},
+		{"/graphql", "application/graphql", http.StatusOK, "graphql"},
+		{"/graphql", "text/plain", http.StatusOK, "text"},
+		{"/graphql", "application/xml", http.StatusUnsupportedMediaType, ""},
+		{"/graphql", "", http.StatusUnsupportedMediaType, ""},
+		{"/any", "application/json", http.StatusOK, "json"},
+		{"/any", "application/xml", http.StatusOK, "any"},
+		{"/any", "", http.StatusOK, "any"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("POST", test.route, nil)
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != test.code {
+			t.Errorf("%s %q: expecting code %d got %d", test.route, test.contentType, test.code, rw.Code)
+		}
+		if test.body != "" && rw.Body.String() != test.body {
+			t.Errorf("%s %q: expecting body %s got %s", test.route, test.contentType, test.body, rw.Body.String())
+		}
+	}
+}
+
+func TestByAccept(t *testing.T) {
+	w := New()
+	w.Get("/users/1", ByAccept(map[string]Handler{
+		"application/json": textHandler("json"),
+		"text/html":        textHandler("html"),
+	}))
+
+	tests := []struct {
+		accept string
+		code   int
+		body   string
+	}{
+		{"", http.StatusOK, "json"},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", http.StatusOK, "html"},
+		{"application/json", http.StatusOK, "json"},
+		{"text/*", http.StatusOK, "html"},
+		{"*/*", http.StatusOK, "json"},
+		{"image/png", http.StatusNotAcceptable, ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/users/1", nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != test.code {
+			t.Errorf("%q: expecting code %d got %d", test.accept, test.code, rw.Code)
+		}
+		if test.body != "" && rw.Body.String() != test.body {
+			t.Errorf("%q: expecting body %s got %s", test.accept, test.body, rw.Body.String())
+		}
+		if rw.Header().Get("Vary") != "Accept" {
+			t.Errorf("%q: expecting Vary: Accept", test.accept)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package weavebox
+
+import "sync"
+
+// middlewareMu serializes the changes to the middleware of all boxes. Requests
+// read the middleware without locking, each change stores a new slice.
+var middlewareMu sync.Mutex
+
+// namedHandler is a middleware Handler, name is empty for middleware
+// registered with Use. box is the Weavebox the middleware was registered on,
+// the boxes created from it hold a copy.
+type namedHandler struct {
+	name string
+	h    Handler
+	box  *Weavebox
+}
+
+// loadMiddleware returns a copy of the middleware of w that can be modified
+// and stored. It must be called with middlewareMu held.
+func (w *Weavebox) loadMiddleware() []namedHandler {
+	mw, _ := w.middleware.Load().([]namedHandler)
+	return append([]namedHandler(nil), mw...)
+}
+
+// UseNamed appends a Handler to the box middleware under the given name, so
+// it can be removed or replaced later with RemoveMiddleware and
+// ReplaceMiddleware, even while requests are served. If a middleware with the
+// name is already registered it is replaced in place, like ReplaceMiddleware
+// does.
+// 	app.UseNamed("ratelimit", rateLimit)
+// 	..
+// 	app.RemoveMiddleware("ratelimit")
+func (w *Weavebox) UseNamed(name string, h Handler) {
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+	mw := w.loadMiddleware()
+	if i := middlewareIndex(mw, name); i >= 0 {
+		w.propagate(name, mw[i].box, h)
+		mw[i] = namedHandler{name: name, h: h, box: w}
+	} else {
+		mw = append(mw, namedHandler{name: name, h: h, box: w})
+	}
+	w.middleware.Store(mw)
+}
+
+// RemoveMiddleware removes the middleware registered with UseNamed under the
+// given name from the box and the boxes created from it, unless a box
+// registered a middleware of its own under the name. It reports whether the
+// middleware was found.
+func (w *Weavebox) RemoveMiddleware(name string) bool {
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+	mw := w.loadMiddleware()
+	i := middlewareIndex(mw, name)
+	if i < 0 {
+		return false
+	}
+	w.propagate(name, mw[i].box, nil)
+	w.middleware.Store(append(mw[:i], mw[i+1:]...))
+	return true
+}
+
+// ReplaceMiddleware replaces the middleware registered with UseNamed under the
+// given name, keeping its position in the chain. Like RemoveMiddleware it
+// applies to the boxes created from the box. It reports whether the
+// middleware was found.
+func (w *Weavebox) ReplaceMiddleware(name string, h Handler) bool {
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+	mw := w.loadMiddleware()
+	i := middlewareIndex(mw, name)
+	if i < 0 {
+		return false
+	}
+	w.propagate(name, mw[i].box, h)
+	mw[i] = namedHandler{name: name, h: h, box: w}
+	w.middleware.Store(mw)
+	return true
+}
+
+// propagate replaces the middleware named name in the boxes created from w,
+// as long as they hold the copy registered on owner. A nil h removes it. It
+// must be called with middlewareMu held.
+func (w *Weavebox) propagate(name string, owner *Weavebox, h Handler) {
+	for _, b := range w.root().boxes {
+		if !b.createdFrom(w) {
+			continue
+		}
+		mw := b.loadMiddleware()
+		i := middlewareIndex(mw, name)
+		if i < 0 || mw[i].box != owner {
+			continue
+		}
+		if h == nil {
+			mw = append(mw[:i], mw[i+1:]...)
+		} else {
+			mw[i] = namedHandler{name: name, h: h, box: w}
+		}
+		b.middleware.Store(mw)
+	}
+}
+
+// createdFrom reports whether w is a box created from ancestor, directly or
+// through other boxes.
+func (w *Weavebox) createdFrom(ancestor *Weavebox) bool {
+	for p := w.parent; p != nil; p = p.parent {
+		if p == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// middlewareIndex returns the index of the middleware with the given name, or
+// -1 if there is none.
+func middlewareIndex(mw []namedHandler, name string) int {
+	for i, handler := range mw {
+		if handler.name != "" && handler.name == name {
+			return i
+		}
+	}
+	return -1
+}
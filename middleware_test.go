@@ -0,0 +1,125 @@
+package weavebox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNamedMiddleware(t *testing.T) {
+	w := New()
+	mark := func(s string) Handler {
+		return func(ctx *Context) error {
+			ctx.Response().Header().Add("X-Middleware", s)
+			return nil
+		}
+	}
+	w.Use(mark("a"))
+	w.UseNamed("b", mark("b"))
+	w.UseNamed("c", mark("c"))
+	w.Get("/", noopHandler)
+
+	expectMiddleware := func(expected string) {
+		r, _ := http.NewRequest("GET", "/", nil)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if got := strings.Join(rw.Header()["X-Middleware"], ","); got != expected {
+			t.Errorf("expecting middleware %s got %s", expected, got)
+		}
+	}
+	expectMiddleware("a,b,c")
+
+	if !w.ReplaceMiddleware("b", mark("B")) {
+		t.Error("expecting middleware b to be replaced")
+	}
+	expectMiddleware("a,B,c")
+
+	if !w.RemoveMiddleware("b") {
+		t.Error("expecting middleware b to be removed")
+	}
+	expectMiddleware("a,c")
+
+	if w.RemoveMiddleware("b") || w.ReplaceMiddleware("missing", noopHandler) {
+		t.Error("expecting unknown middleware not to be found")
+	}
+	w.UseNamed("c", mark("C"))
+	expectMiddleware("a,C")
+}
+
+func TestNamedMiddlewareBox(t *testing.T) {
+	w := New()
+	w.UseNamed("auth", func(ctx *Context) error {
+		return NewHTTPError(http.StatusUnauthorized)
+	})
+	box := w.Box("/public")
+	box.Get("/", noopHandler)
+	box.RemoveMiddleware("auth")
+	w.Get("/private", noopHandler)
+
+	code, _ := doRequest(t, "GET", "/public", nil, w)
+	isHTTPStatusOK(t, code)
+	code, _ = doRequest(t, "GET", "/private", nil, w)
+	if code != http.StatusUnauthorized {
+		t.Errorf("expecting the parent to keep its middleware got %d", code)
+	}
+}
+
+func TestNamedMiddlewarePropagates(t *testing.T) {
+	w := New()
+	w.UseNamed("maint", func(ctx *Context) error {
+		return NewHTTPError(http.StatusServiceUnavailable)
+	})
+	api := w.Box("/api")
+	api.Get("/", noopHandler)
+	v1 := api.Box("/v1")
+	v1.Get("/", noopHandler)
+	admin := w.Box("/admin")
+	admin.UseNamed("maint", func(ctx *Context) error {
+		return NewHTTPError(http.StatusForbidden)
+	})
+	admin.Get("/", noopHandler)
+
+	expectCode := func(route string, expected int) {
+		t.Helper()
+		if code, _ := doRequest(t, "GET", route, nil, w); code != expected {
+			t.Errorf("%s: expecting %d got %d", route, expected, code)
+		}
+	}
+	expectCode("/api", http.StatusServiceUnavailable)
+	expectCode("/api/v1", http.StatusServiceUnavailable)
+
+	w.ReplaceMiddleware("maint", func(ctx *Context) error {
+		return NewHTTPError(http.StatusTooManyRequests)
+	})
+	expectCode("/api", http.StatusTooManyRequests)
+	expectCode("/api/v1", http.StatusTooManyRequests)
+	expectCode("/admin", http.StatusForbidden)
+
+	w.RemoveMiddleware("maint")
+	expectCode("/api", http.StatusOK)
+	expectCode("/api/v1", http.StatusOK)
+	expectCode("/admin", http.StatusForbidden)
+}
+
+func TestRemoveMiddlewareConcurrent(t *testing.T) {
+	w := New()
+	w.Get("/", noopHandler)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r, _ := http.NewRequest("GET", "/", nil)
+				w.ServeHTTP(httptest.NewRecorder(), r)
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		w.UseNamed("toggle", noopHandler)
+		w.RemoveMiddleware("toggle")
+	}
+	wg.Wait()
+}
@@ -0,0 +1,169 @@
+package weavebox
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Encoder encodes v to the response body.
+type Encoder func(w io.Writer, v interface{}) error
+
+// defaultEncoders are the encoders Negotiate uses for the media types that have
+// no encoder registered with RegisterEncoder.
+var defaultEncoders = map[string]Encoder{
+	"application/json": func(w io.Writer, v interface{}) error {
+		return json.NewEncoder(w).Encode(v)
+	},
+	"application/xml": func(w io.Writer, v interface{}) error {
+		return xml.NewEncoder(w).Encode(v)
+	},
+}
+
+// RegisterEncoder registers the Encoder Negotiate uses to respond with the
+// given media type. Registering an encoder for "application/json" replaces
+// the encoder used by JSON. Encoders registered on a Box only apply to the
+// routes of the Box.
+// 	app.RegisterEncoder("application/msgpack", func(w io.Writer, v interface{}) error {
+// 		return msgpack.NewEncoder(w).Encode(v)
+// 	})
+func (w *Weavebox) RegisterEncoder(mediaType string, enc Encoder) {
+	if w.encoders == nil {
+		w.encoders = map[string]Encoder{}
+	}
+	w.encoders[mediaType] = enc
+}
+
+// encoder returns the Encoder for mediaType, or nil if there is none. The
+// default JSON encoder indents by JSONIndent.
+func (w *Weavebox) encoder(mediaType string) Encoder {
+	indent := w.JSONIndent
+	for ; w != nil; w = w.parent {
+		if enc, ok := w.encoders[mediaType]; ok {
+			return enc
+		}
+	}
+	if mediaType == "application/json" && indent != "" {
+		return func(w io.Writer, v interface{}) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", indent)
+			return enc.Encode(v)
+		}
+	}
+	return defaultEncoders[mediaType]
+}
+
+// mediaTypes returns the sorted media types there is an Encoder for.
+func (w *Weavebox) mediaTypes() []string {
+	seen := map[string]bool{}
+	for mediaType := range defaultEncoders {
+		seen[mediaType] = true
+	}
+	for ; w != nil; w = w.parent {
+		for mediaType := range w.encoders {
+			seen[mediaType] = true
+		}
+	}
+	types := make([]string, 0, len(seen))
+	for mediaType := range seen {
+		types = append(types, mediaType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Negotiate responds v encoded in the media type that best matches the Accept
+// header of the request, using the encoders registered with RegisterEncoder.
+// JSON and XML are supported out of the box. If the client accepts none of
+// the media types, v is responded as JSON.
+// 	return ctx.Negotiate(http.StatusOK, user)
+func (c *Context) Negotiate(code int, v interface{}) error {
+	c.Response().Header().Add("Vary", "Accept")
+	return c.encode(code, c.negotiate(), v)
+}
+
+// negotiate returns the media type to respond with.
+func (c *Context) negotiate() string {
+	type accept struct {
+		mediaType string
+		q         float64
+	}
+	var accepts []accept
+	for _, part := range strings.Split(c.request.Header.Get("Accept"), ",") {
+		mediaType, q := parseQuality(part)
+		if mediaType != "" && q > 0 {
+			accepts = append(accepts, accept{mediaType, q})
+		}
+	}
+	sort.SliceStable(accepts, func(i, j int) bool {
+		return accepts[i].q > accepts[j].q
+	})
+
+	types := c.weavebox.mediaTypes()
+	for _, a := range accepts {
+		if a.mediaType == "*/*" {
+			break
+		}
+		if strings.HasSuffix(a.mediaType, "/*") {
+			if strings.HasPrefix("application/json", a.mediaType[:len(a.mediaType)-1]) {
+				return "application/json"
+			}
+			for _, mediaType := range types {
+				if strings.HasPrefix(mediaType, a.mediaType[:len(a.mediaType)-1]) {
+					return mediaType
+				}
+			}
+			continue
+		}
+		if c.weavebox.encoder(a.mediaType) != nil {
+			return a.mediaType
+		}
+	}
+	return "application/json"
+}
+
+// encode writes the status code and v encoded with the Encoder for mediaType.
+func (c *Context) encode(code int, mediaType string, v interface{}) error {
+	c.Response().Header().Set("Content-Type", mediaType)
+	c.Response().WriteHeader(code)
+	return c.weavebox.encoder(mediaType)(c.Response(), v)
+}
+
+// accepts returns the offer that best matches the Accept header of the
+// request. When offers match equally well, or the request has no Accept
+// header, the first offer is returned. It returns an empty string if the
+// client accepts none of the offers.
+func (c *Context) accepts(offers ...string) string {
+	header := c.request.Header.Get("Accept")
+	if header == "" {
+		return offers[0]
+	}
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, offer := range offers {
+		q, specificity := 0.0, -1
+		for _, part := range strings.Split(header, ",") {
+			mediaType, quality := parseQuality(part)
+			s := -1
+			switch {
+			case mediaType == offer:
+				s = 2
+			case strings.HasSuffix(mediaType, "/*") && strings.HasPrefix(offer, mediaType[:len(mediaType)-1]):
+				s = 1
+			case mediaType == "*/*":
+				s = 0
+			}
+			if s > specificity {
+				q, specificity = quality, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
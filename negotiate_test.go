@@ -0,0 +1,110 @@
+package weavebox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContextNegotiate(t *testing.T) {
+	w := New()
+	w.RegisterEncoder("application/msgpack", func(w io.Writer, v interface{}) error {
+		_, err := fmt.Fprintf(w, "msgpack:%s", v.(*bindUser).Name)
+		return err
+	})
+	w.Get("/", func(ctx *Context) error {
+		return ctx.Negotiate(http.StatusOK, &bindUser{Name: "anthony"})
+	})
+
+	tests := []struct {
+		accept, contentType, body string
+	}{
+		{"", "application/json", "{\"name\":\"anthony\"}\n"},
+		{"*/*", "application/json", "{\"name\":\"anthony\"}\n"},
+		{"application/xml", "application/xml", "<bindUser><name>anthony</name></bindUser>"},
+		{"application/msgpack", "application/msgpack", "msgpack:anthony"},
+		{"application/xml;q=0.5, application/msgpack", "application/msgpack", "msgpack:anthony"},
+		{"text/html, application/*;q=0.9", "application/json", "{\"name\":\"anthony\"}\n"},
+		{"text/html, image/png", "application/json", "{\"name\":\"anthony\"}\n"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", test.accept)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		isHTTPStatusOK(t, rw.Code)
+		if ct := rw.Header().Get("Content-Type"); ct != test.contentType {
+			t.Errorf("%q: expecting content type %s got %s", test.accept, test.contentType, ct)
+		}
+		if rw.Body.String() != test.body {
+			t.Errorf("%q: expecting body %q got %q", test.accept, test.body, rw.Body.String())
+		}
+		if rw.Header().Get("Vary") != "Accept" {
+			t.Errorf("%q: expecting Vary: Accept got %s", test.accept, rw.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestRegisterEncoderJSON(t *testing.T) {
+	w := New()
+	w.RegisterEncoder("application/json", func(w io.Writer, v interface{}) error {
+		_, err := io.WriteString(w, "custom")
+		return err
+	})
+	w.Get("/", func(ctx *Context) error {
+		return ctx.JSON(http.StatusOK, nil)
+	})
+	code, body := doRequest(t, "GET", "/", nil, w)
+	isHTTPStatusOK(t, code)
+	if body != "custom" {
+		t.Errorf("expecting JSON to use the registered encoder got %s", body)
+	}
+}
+
+func TestContextNegotiateError(t *testing.T) {
+	w := New()
+	w.SetTemplateEngine(errorRenderer{})
+	w.SetErrorHandler(func(ctx *Context, err error) {
+		ctx.NegotiateError(err, "error.html")
+	})
+	w.Get("/missing", func(ctx *Context) error {
+		return NewHTTPError(http.StatusNotFound, "user not found")
+	})
+	w.Get("/fail", func(ctx *Context) error {
+		return errors.New("oops")
+	})
+
+	tests := []struct {
+		path, accept string
+		code         int
+		contentType  string
+		body         string
+	}{
+		{"/missing", "", http.StatusNotFound, "application/json", "{\"error\":{\"code\":404,\"message\":\"user not found\"}}\n"},
+		{"/missing", "application/json", http.StatusNotFound, "application/json", "{\"error\":{\"code\":404,\"message\":\"user not found\"}}\n"},
+		{"/missing", "text/html,application/xhtml+xml,*/*;q=0.8", http.StatusNotFound, "text/html; charset=utf-8", "<h1>404 user not found</h1>"},
+		{"/fail", "text/html", http.StatusInternalServerError, "text/html; charset=utf-8", "<h1>500 oops</h1>"},
+		{"/fail", "application/json, text/html;q=0.5", http.StatusInternalServerError, "application/json", "{\"error\":{\"code\":500,\"message\":\"oops\"}}\n"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		r.Header.Set("Accept", test.accept)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != test.code || rw.Header().Get("Content-Type") != test.contentType || rw.Body.String() != test.body {
+			t.Errorf("%s %q: expecting %d %s %q got %d %s %q", test.path, test.accept, test.code, test.contentType, test.body,
+				rw.Code, rw.Header().Get("Content-Type"), rw.Body.String())
+		}
+	}
+}
+
+type errorRenderer struct{}
+
+func (errorRenderer) Render(w io.Writer, name string, data interface{}) error {
+	e := data.(*HTTPError)
+	_, err := fmt.Fprintf(w, "<h1>%d %s</h1>", e.Code, e.Message)
+	return err
+}
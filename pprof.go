@@ -0,0 +1,44 @@
+package weavebox
+
+import (
+	"net/http/pprof"
+	"strings"
+)
+
+// EnablePprof mounts the net/http/pprof profiling endpoints under prefix. The
+// guard runs before every endpoint, it is expected to return an error for
+// requests that are not allowed to profile the app. The endpoints are only
+// served by the app once EnablePprof is called.
+// 	app.EnablePprof("/debug/pprof", func(ctx *weavebox.Context) error {
+// 		if ctx.Header("X-Admin-Token") != token {
+// 			return weavebox.NewHTTPError(http.StatusUnauthorized)
+// 		}
+// 		return nil
+// 	})
+func (w *Weavebox) EnablePprof(prefix string, guard Handler) {
+	b := w.Box(prefix)
+	if guard != nil {
+		b.Use(guard)
+	}
+	b.Get("/*name", servePprof)
+	b.Post("/*name", servePprof)
+}
+
+func servePprof(ctx *Context) error {
+	rw, r := ctx.Response(), ctx.Request()
+	switch name := strings.TrimPrefix(ctx.Param("name"), "/"); name {
+	case "":
+		pprof.Index(rw, r)
+	case "cmdline":
+		pprof.Cmdline(rw, r)
+	case "profile":
+		pprof.Profile(rw, r)
+	case "symbol":
+		pprof.Symbol(rw, r)
+	case "trace":
+		pprof.Trace(rw, r)
+	default:
+		pprof.Handler(name).ServeHTTP(rw, r)
+	}
+	return nil
+}
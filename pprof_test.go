@@ -0,0 +1,46 @@
+package weavebox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEnablePprof(t *testing.T) {
+	w := New()
+	guarded := 0
+	w.EnablePprof("/debug/pprof", func(ctx *Context) error {
+		guarded++
+		if ctx.Header("X-Admin-Token") != "secret" {
+			return NewHTTPError(http.StatusUnauthorized)
+		}
+		return nil
+	})
+
+	code, _ := doRequest(t, "GET", "/debug/pprof/", nil, w)
+	if code != http.StatusUnauthorized {
+		t.Errorf("expecting code 401 got %d", code)
+	}
+
+	tests := []struct {
+		path, body string
+	}{
+		{"/debug/pprof/", "goroutine"},
+		{"/debug/pprof/cmdline", ""},
+		{"/debug/pprof/goroutine?debug=1", "goroutine profile"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		r.Header.Set("X-Admin-Token", "secret")
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		isHTTPStatusOK(t, rw.Code)
+		if !strings.Contains(rw.Body.String(), test.body) {
+			t.Errorf("%s: expecting body containing %s got %s", test.path, test.body, rw.Body.String())
+		}
+	}
+	if guarded != 4 {
+		t.Errorf("expecting the guard to run for each request got %d", guarded)
+	}
+}
@@ -0,0 +1,30 @@
+package weavebox
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrTooManyRequests is returned by Context.TooManyRequests. The default
+// ErrorHandler responds it with 429 Too Many Requests.
+var ErrTooManyRequests = NewHTTPError(http.StatusTooManyRequests)
+
+// TooManyRequests sets the headers of a response to a client over its rate
+// limit and returns ErrTooManyRequests, to be returned by the handler. The
+// Retry-After and X-RateLimit-Reset headers are set to retryAfter in whole
+// seconds, rounded up, and X-RateLimit-Remaining to 0. An X-RateLimit-Limit
+// header set before is kept.
+// 	if !quota.Allow(user.ID) {
+// 		return ctx.TooManyRequests(quota.Reset(user.ID))
+// 	}
+func (c *Context) TooManyRequests(retryAfter time.Duration) error {
+	h := c.Response().Header()
+	h.Set("X-RateLimit-Remaining", "0")
+	if retryAfter > 0 {
+		secs := strconv.FormatInt(int64((retryAfter+time.Second-1)/time.Second), 10)
+		h.Set("Retry-After", secs)
+		h.Set("X-RateLimit-Reset", secs)
+	}
+	return ErrTooManyRequests
+}
@@ -0,0 +1,40 @@
+package weavebox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContextTooManyRequests(t *testing.T) {
+	tests := []struct {
+		retryAfter time.Duration
+		expected   string
+	}{
+		{30 * time.Second, "30"},
+		{1500 * time.Millisecond, "2"},
+		{time.Millisecond, "1"},
+		{0, ""},
+	}
+	for _, test := range tests {
+		w := New()
+		w.Get("/", func(ctx *Context) error {
+			ctx.Response().Header().Set("X-RateLimit-Limit", "100")
+			return ctx.TooManyRequests(test.retryAfter)
+		})
+		r, _ := http.NewRequest("GET", "/", nil)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != http.StatusTooManyRequests {
+			t.Errorf("%s: expecting code 429 got %d", test.retryAfter, rw.Code)
+		}
+		h := rw.Header()
+		if h.Get("Retry-After") != test.expected || h.Get("X-RateLimit-Reset") != test.expected {
+			t.Errorf("%s: expecting Retry-After %q got %q", test.retryAfter, test.expected, h.Get("Retry-After"))
+		}
+		if h.Get("X-RateLimit-Remaining") != "0" || h.Get("X-RateLimit-Limit") != "100" {
+			t.Errorf("%s: expecting the rate limit headers got %v", test.retryAfter, h)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package weavebox
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RealIP returns the IP address of the client as determined by the
+// RemoteAddrFunc of the app. By default it is the host of the RemoteAddr of
+// the request. For requests from one of the TrustedProxies the X-Forwarded-For
+// header is honored, and then X-Real-IP. The addresses in X-Forwarded-For are
+// walked from the last one, added by the nearest proxy, to the first, and the
+// first address that is not a trusted proxy is returned, so clients can not
+// spoof their address by sending the header themselves.
+// 	app.TrustedProxies = []string{"10.0.0.0/8"}
+// 	X-Forwarded-For: 203.0.113.7, 10.0.0.2 => ctx.RealIP() == "203.0.113.7"
+func (c *Context) RealIP() string {
+	return c.weavebox.root().remoteAddr(c.request)
+}
+
+// remoteAddr returns the address of the client using RemoteAddrFunc, or the
+// address forwarded by a trusted proxy or the host of the request's
+// RemoteAddr if no RemoteAddrFunc is set.
+func (w *Weavebox) remoteAddr(r *http.Request) string {
+	if w.RemoteAddrFunc != nil {
+		return w.RemoteAddrFunc(r)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if len(w.TrustedProxies) == 0 || !w.trustedIP(host) {
+		return host
+	}
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		addrs := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			addr := strings.TrimSpace(addrs[i])
+			if net.ParseIP(addr) == nil {
+				break
+			}
+			host = addr
+			if !w.trustedIP(addr) {
+				return addr
+			}
+		}
+		return host
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(ip) != nil {
+		return ip
+	}
+	return host
+}
+
+// Scheme returns "https" if the request was made over TLS, or forwarded as
+// such by a trusted proxy in its X-Forwarded-Proto header, and "http"
+// otherwise. Of a list of protocols the last one is used, which is the one
+// added by the nearest proxy.
+// 	url := ctx.Scheme() + "://" + ctx.Request().Host + "/login"
+func (c *Context) Scheme() string {
+	if c.request.TLS != nil {
+		return "https"
+	}
+	w := c.weavebox.root()
+	if protos := c.request.Header.Values("X-Forwarded-Proto"); len(protos) > 0 && w.trustedProxy(c.request) {
+		proto := protos[len(protos)-1]
+		if i := strings.LastIndexByte(proto, ','); i >= 0 {
+			proto = proto[i+1:]
+		}
+		if strings.EqualFold(strings.TrimSpace(proto), "https") {
+			return "https"
+		}
+	}
+	return "http"
+}
+
+// trustedProxy reports whether the request was sent by one of the
+// TrustedProxies.
+func (w *Weavebox) trustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return w.trustedIP(host)
+}
+
+// trustedIP reports whether the address is one of the TrustedProxies.
+func (w *Weavebox) trustedIP(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range w.TrustedProxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if proxyIP := net.ParseIP(proxy); proxyIP != nil && proxyIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
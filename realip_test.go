@@ -0,0 +1,130 @@
+package weavebox
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContextRealIP(t *testing.T) {
+	w := New()
+	w.Get("/", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, ctx.RealIP())
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:51234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Body.String() != "10.0.0.1" {
+		t.Errorf("expecting 10.0.0.1 got %s", rw.Body.String())
+	}
+}
+
+func TestContextRealIPTrustedProxies(t *testing.T) {
+	w := New()
+	w.TrustedProxies = []string{"10.0.0.0/8"}
+	w.Box("/sub").Get("/", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, ctx.RealIP())
+	})
+
+	tests := []struct {
+		remoteAddr string
+		xff        string
+		realIP     string
+		expected   string
+	}{
+		{"203.0.113.7:4000", "198.51.100.1", "198.51.100.2", "203.0.113.7"},
+		{"10.0.0.1:4000", "", "", "10.0.0.1"},
+		{"10.0.0.1:4000", "203.0.113.7", "", "203.0.113.7"},
+		{"10.0.0.1:4000", " 198.51.100.1 , 203.0.113.7, 10.0.0.2", "", "203.0.113.7"},
+		{"10.0.0.1:4000", "10.0.0.3, 10.0.0.2", "", "10.0.0.3"},
+		{"10.0.0.1:4000", "203.0.113.7, garbage", "", "10.0.0.1"},
+		{"10.0.0.1:4000", "", "198.51.100.2", "198.51.100.2"},
+		{"10.0.0.1:4000", "203.0.113.7", "198.51.100.2", "203.0.113.7"},
+		{"10.0.0.1:4000", "", "garbage", "10.0.0.1"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/sub", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.xff != "" {
+			r.Header.Set("X-Forwarded-For", test.xff)
+		}
+		if test.realIP != "" {
+			r.Header.Set("X-Real-IP", test.realIP)
+		}
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Body.String() != test.expected {
+			t.Errorf("%s %q %q: expecting %s got %s", test.remoteAddr, test.xff, test.realIP, test.expected, rw.Body.String())
+		}
+	}
+}
+
+func TestRemoteAddrFunc(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := New()
+	w.Output = buf
+	w.EnableAccessLog = true
+	w.RemoteAddrFunc = func(r *http.Request) string {
+		return r.Header.Get("X-Forwarded-For")
+	}
+	sub := w.Box("/sub")
+	sub.Get("/", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, ctx.RealIP())
+	})
+	r, _ := http.NewRequest("GET", "/sub", nil)
+	r.RemoteAddr = "10.0.0.1:51234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Body.String() != "203.0.113.7" {
+		t.Errorf("expecting 203.0.113.7 got %s", rw.Body.String())
+	}
+	if !strings.HasPrefix(buf.String(), "203.0.113.7 - - [") {
+		t.Errorf("expecting the log line to start with the client address got %s", buf.String())
+	}
+}
+
+func TestContextScheme(t *testing.T) {
+	w := New()
+	w.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.1"}
+	w.Box("/sub").Get("/", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, ctx.Scheme())
+	})
+
+	tests := []struct {
+		remoteAddr string
+		proto      string
+		tls        bool
+		expected   string
+	}{
+		{"203.0.113.7:4000", "", false, "http"},
+		{"203.0.113.7:4000", "", true, "https"},
+		{"203.0.113.7:4000", "https", false, "http"},
+		{"10.1.2.3:4000", "https", false, "https"},
+		{"10.1.2.3:4000", "HTTPS, http", false, "http"},
+		{"10.1.2.3:4000", "http, HTTPS", false, "https"},
+		{"192.168.1.1:4000", "https", false, "https"},
+		{"192.168.1.2:4000", "https", false, "http"},
+		{"10.1.2.3:4000", "http", false, "http"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/sub", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", test.proto)
+		}
+		if test.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Body.String() != test.expected {
+			t.Errorf("%s %q: expecting %s got %s", test.remoteAddr, test.proto, test.expected, rw.Body.String())
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package weavebox
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// PanicError is passed to the ErrorHandler when a handler panics and
+// RecoverPanics is set.
+type PanicError struct {
+	// Value is the value the handler panicked with.
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+// Error satisfies the error interface
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// recoverPanic is deferred by handle to pass the panic of a handler to the
+// ErrorHandler. http.ErrAbortHandler is not recovered, it aborts the response
+// as intended.
+func (w *Weavebox) recoverPanic(ctx *Context) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+	if rec == http.ErrAbortHandler {
+		panic(rec)
+	}
+	err := &PanicError{Value: rec, Stack: debug.Stack()}
+	if root := w.root(); root.EnableAccessLog {
+		fmt.Fprintf(root.Output, "%s [%s %s]\n%s", err, ctx.request.Method, ctx.request.URL.Path, err.Stack)
+	}
+	w.handleError(ctx, err)
+}
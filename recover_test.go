@@ -0,0 +1,51 @@
+package weavebox
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	buf := &bytes.Buffer{}
+	var recovered error
+	w := New()
+	w.RecoverPanics = true
+	w.EnableAccessLog = true
+	w.Output = buf
+	api := w.Box("/api")
+	api.SetErrorHandler(func(ctx *Context, err error) {
+		recovered = err
+		defaultErrorHandler(ctx, err)
+	})
+	api.Get("/panic", func(ctx *Context) error {
+		panic("boom")
+	})
+	api.Get("/abort", func(ctx *Context) error {
+		panic(http.ErrAbortHandler)
+	})
+
+	code, body := doRequest(t, "GET", "/api/panic", nil, w)
+	if code != http.StatusInternalServerError {
+		t.Errorf("expecting code 500 got %d", code)
+	}
+	if strings.Contains(body, "boom") {
+		t.Errorf("expecting the panic value not to be responded got %s", body)
+	}
+	if e, ok := recovered.(*PanicError); !ok || e.Value != "boom" || len(e.Stack) == 0 {
+		t.Errorf("expecting a PanicError with its stack got %v", recovered)
+	}
+	if out := buf.String(); !strings.Contains(out, "panic: boom [GET /api/panic]") || !strings.Contains(out, "recover_test.go") {
+		t.Errorf("expecting the stack trace to be logged got %s", out)
+	}
+
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("expecting http.ErrAbortHandler not to be recovered got %v", rec)
+		}
+	}()
+	r, _ := http.NewRequest("GET", "/api/abort", nil)
+	w.ServeHTTP(httptest.NewRecorder(), r)
+}
@@ -0,0 +1,42 @@
+package weavebox
+
+// EnvelopeFunc wraps the data or error of a response in the envelope
+// responded by Respond.
+type EnvelopeFunc func(data interface{}, err error) interface{}
+
+// SetEnvelope sets the envelope Respond wraps the responses in. A Box uses
+// the envelope of its parent unless it is set on the box. JSON is never
+// wrapped, so raw responses remain available.
+// 	app.SetEnvelope(func(data interface{}, err error) interface{} {
+// 		if err != nil {
+// 			return map[string]interface{}{"status": "error", "error": err.Error()}
+// 		}
+// 		return map[string]interface{}{"status": "ok", "data": data}
+// 	})
+func (w *Weavebox) SetEnvelope(fn EnvelopeFunc) {
+	w.envelope = fn
+}
+
+func (w *Weavebox) envelopeFunc() EnvelopeFunc {
+	for ; w != nil; w = w.parent {
+		if w.envelope != nil {
+			return w.envelope
+		}
+	}
+	return nil
+}
+
+// Respond writes the status code and data, or err if it is not nil, as JSON
+// wrapped in the envelope set with SetEnvelope. Without an envelope data is
+// responded as is and err as {"error": {"code": 500, "message": "..."}}.
+// 	users, err := db.Users()
+// 	return ctx.Respond(http.StatusOK, users, err)
+func (c *Context) Respond(code int, data interface{}, err error) error {
+	if envelope := c.weavebox.envelopeFunc(); envelope != nil {
+		return c.JSON(code, envelope(data, err))
+	}
+	if err != nil {
+		return c.JSON(code, map[string]*HTTPError{"error": NewHTTPError(code, err.Error())})
+	}
+	return c.JSON(code, data)
+}
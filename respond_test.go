@@ -0,0 +1,45 @@
+package weavebox
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestContextRespond(t *testing.T) {
+	w := New()
+	handler := func(ctx *Context) error {
+		if ctx.Query("fail") != "" {
+			return ctx.Respond(http.StatusBadRequest, nil, errors.New("invalid id"))
+		}
+		return ctx.Respond(http.StatusOK, map[string]int{"id": 1}, nil)
+	}
+	w.Get("/raw", handler)
+	legacy := w.Box("/legacy")
+	legacy.SetEnvelope(func(data interface{}, err error) interface{} {
+		if err != nil {
+			return map[string]interface{}{"status": "error", "error": err.Error()}
+		}
+		return map[string]interface{}{"status": "ok", "data": data}
+	})
+	legacy.Get("/", handler)
+	legacy.Box("/v2").Get("/", handler)
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/raw", http.StatusOK, `{"id":1}`},
+		{"/raw?fail=1", http.StatusBadRequest, `{"error":{"code":400,"message":"invalid id"}}`},
+		{"/legacy", http.StatusOK, `{"data":{"id":1},"status":"ok"}`},
+		{"/legacy?fail=1", http.StatusBadRequest, `{"error":"invalid id","status":"error"}`},
+		{"/legacy/v2", http.StatusOK, `{"data":{"id":1},"status":"ok"}`},
+	}
+	for _, test := range tests {
+		code, body := doRequest(t, "GET", test.path, nil, w)
+		if code != test.code || body != test.body+"\n" {
+			t.Errorf("%s: expecting %d %s got %d %s", test.path, test.code, test.body, code, body)
+		}
+	}
+}
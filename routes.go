@@ -0,0 +1,71 @@
+package weavebox
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// GetNamed registers a GET route like Get does, under a name URL builds the
+// path of the route from. Names are unique across the app and its boxes,
+// registering a name twice panics.
+// 	app.GetNamed("user_detail", "/users/:id", showUser)
+func (w *Weavebox) GetNamed(name, route string, h Handler, middleware ...Handler) {
+	w.HandleNamed(name, "GET", route, h, middleware...)
+}
+
+// HandleNamed registers a route like Handle does, under a name URL builds the
+// path of the route from.
+// 	app.HandleNamed("user_update", "PUT", "/users/:id", updateUser)
+func (w *Weavebox) HandleNamed(name, method, route string, h Handler, middleware ...Handler) {
+	root := w.root()
+	if _, ok := root.routeNames[name]; ok {
+		panic(fmt.Sprintf("weavebox: route name %q is already registered", name))
+	}
+	if root.routeNames == nil {
+		root.routeNames = map[string]string{}
+	}
+	root.routeNames[name] = w.routePath(route)
+	w.add(method, route, h, middleware...)
+}
+
+// URL returns the path of the route registered with the given name, including
+// the prefix of its box and the prefix set with StripPrefix. The parameters of
+// the route are replaced by params in order, escaped as path segments. The
+// value of a catch-all parameter may hold slashes. It returns an error if no
+// route has the name or the number of params does not match the parameters of
+// the route. URL can be added to the functions of templates to link to routes
+// by their name.
+// 	app.GetNamed("user_detail", "/users/:id", showUser)
+// 	app.URL("user_detail", "42") // "/users/42"
+// 	template.FuncMap{"url": app.URL}
+func (w *Weavebox) URL(name string, params ...string) (string, error) {
+	root := w.root()
+	route, ok := root.routeNames[name]
+	if !ok {
+		return "", fmt.Errorf("weavebox: unknown route %q", name)
+	}
+	segments := strings.Split(route, "/")
+	n := 0
+	for i, seg := range segments {
+		if seg == "" || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		if n < len(params) {
+			if seg[0] == '*' {
+				parts := strings.Split(strings.TrimPrefix(params[n], "/"), "/")
+				for j, part := range parts {
+					parts[j] = url.PathEscape(part)
+				}
+				segments[i] = strings.Join(parts, "/")
+			} else {
+				segments[i] = url.PathEscape(params[n])
+			}
+		}
+		n++
+	}
+	if n != len(params) {
+		return "", fmt.Errorf("weavebox: route %q has %d parameters, got %d", name, n, len(params))
+	}
+	return root.stripPrefix + strings.Join(segments, "/"), nil
+}
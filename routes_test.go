@@ -0,0 +1,65 @@
+package weavebox
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNamedRoutes(t *testing.T) {
+	w := New()
+	w.GetNamed("user_detail", "/users/:id", noopHandler)
+	api := w.Box("/api")
+	api.HandleNamed("file", "PUT", "/files/:owner/*path", noopHandler)
+	w.GetNamed("home", "/", noopHandler)
+	w.GetNamed("users", "/users/", noopHandler)
+
+	tests := []struct {
+		name     string
+		method   string
+		params   []string
+		expected string
+	}{
+		{"user_detail", "GET", []string{"42"}, "/users/42"},
+		{"user_detail", "GET", []string{"a b?"}, "/users/a%20b%3F"},
+		{"file", "PUT", []string{"anthony", "/docs/q1 report.pdf"}, "/api/files/anthony/docs/q1%20report.pdf"},
+		{"home", "GET", nil, "/"},
+		{"users", "GET", nil, "/users"},
+	}
+	for _, test := range tests {
+		u, err := api.URL(test.name, test.params...)
+		if err != nil {
+			t.Errorf("%s: expecting no error got %v", test.name, err)
+			continue
+		}
+		if u != test.expected {
+			t.Errorf("%s: expecting %s got %s", test.name, test.expected, u)
+		}
+		if code, _ := doRequest(t, test.method, u, nil, w); code != http.StatusOK {
+			t.Errorf("%s: expecting %s to be served got %d", test.name, u, code)
+		}
+	}
+
+	for _, params := range [][]string{nil, {"1", "2"}} {
+		if _, err := w.URL("user_detail", params...); err == nil {
+			t.Errorf("expecting an error for %d params", len(params))
+		}
+	}
+	if _, err := w.URL("missing"); err == nil {
+		t.Error("expecting an error for an unknown route")
+	}
+
+	w.StripPrefix("/service/")
+	if u, _ := w.URL("user_detail", "42"); u != "/service/users/42" {
+		t.Errorf("expecting the stripped prefix to be prepended got %s", u)
+	}
+	if code, _ := doRequest(t, "GET", "/service/users/42", nil, w); code != http.StatusOK {
+		t.Errorf("expecting the URL to be served behind the prefix got %d", code)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expecting registering a name twice to panic")
+		}
+	}()
+	api.GetNamed("user_detail", "/other", noopHandler)
+}
@@ -1,45 +1,147 @@
 package weavebox
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/bradfitz/http2"
+	"golang.org/x/net/netutil"
 )
 
 const useClosedConn = "use of closed network connection"
 
+// errUnsupportedSocketOption is returned when ReusePort or ListenBacklog are
+// set on a platform that does not support them.
+var errUnsupportedSocketOption = fmt.Errorf("weavebox: socket option not supported on %s", runtime.GOOS)
+
+// drainReportInterval is the interval the remaining connections are reported
+// while the server drains.
+var drainReportInterval = time.Second
+
+// cancelGracePeriod is the time requests are given to return after their
+// context is canceled, before their connections are closed.
+var cancelGracePeriod = time.Second
+
 // Server provides a gracefull shutdown of http server.
 type server struct {
 	*http.Server
 	quit  chan struct{}
 	fquit chan struct{}
 	wg    sync.WaitGroup
+	// conns counts the open connections tracked by wg.
+	conns int64
+	// output reports the progress of draining the connections.
+	output io.Writer
+	// network is the network passed to net.Listen, defaults to "tcp".
+	network string
+	// certs holds the certificate served by ListenAndServeTLS.
+	certs *certStore
+	// timeout is the time connections are given to drain before the
+	// contexts of their requests are canceled. Zero waits until all
+	// connections are closed.
+	timeout time.Duration
+	// cancel cancels the contexts of the requests being served.
+	cancel context.CancelFunc
+	// maxConns limits the connections accepted at the same time, zero means
+	// unlimited.
+	maxConns int
+	// reusePort sets SO_REUSEPORT on the listening socket.
+	reusePort bool
+	// mu guards listener and stop, which are set once the server serves.
+	mu       sync.Mutex
+	listener net.Listener
+	// stop is closed by shutdown.
+	stop chan struct{}
+	// backlog is the size of the queue of connections waiting to be
+	// accepted, zero uses the default of the system.
+	backlog int
+}
+
+// certStore holds a TLS certificate that can be replaced while the server is
+// running.
+type certStore struct {
+	mu   sync.RWMutex
+	cert *tls.Certificate
 }
 
-func newServer(addr string, h http.Handler, HTTP2 bool) *http.Server {
+// load loads the certificate from a pair of files. The current certificate is
+// kept if the files fail to load.
+func (c *certStore) load(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *certStore) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.cert == nil {
+		return nil, errors.New("no certificate loaded")
+	}
+	return c.cert, nil
+}
+
+const (
+	defaultReadTimeout  = 5 * time.Second
+	defaultWriteTimeout = 10 * time.Second
+)
+
+func newServer(addr string, w *Weavebox) *http.Server {
 	srv := &http.Server{
 		Addr:         addr,
-		Handler:      h,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		Handler:      w,
+		ReadTimeout:  serverTimeout(w.ReadTimeout, defaultReadTimeout),
+		WriteTimeout: serverTimeout(w.WriteTimeout, defaultWriteTimeout),
+		IdleTimeout:  idleTimeout(w.IdleTimeout),
 	}
-	if HTTP2 {
+	if w.HTTP2 {
 		http2.ConfigureServer(srv, &http2.Server{})
 	}
 	return srv
 }
 
+// serverTimeout returns d, or def if d is zero. A negative d disables the
+// timeout.
+func serverTimeout(d, def time.Duration) time.Duration {
+	switch {
+	case d < 0:
+		return 0
+	case d == 0:
+		return def
+	}
+	return d
+}
+
+// idleTimeout returns d, or the longest duration if d is negative. An
+// IdleTimeout of zero makes the server fall back to the ReadTimeout.
+func idleTimeout(d time.Duration) time.Duration {
+	if d < 0 {
+		return math.MaxInt64
+	}
+	return d
+}
+
 func (s *server) ListenAndServe() error {
-	l, err := net.Listen("tcp", s.Addr)
+	l, err := s.listen()
 	if err != nil {
 		return err
 	}
@@ -47,40 +149,77 @@ func (s *server) ListenAndServe() error {
 }
 
 func (s *server) ListenAndServeTLS(cert, key string) error {
-	var err error
 	config := &tls.Config{}
 	if s.TLSConfig != nil {
-		*config = *s.TLSConfig
+		config = s.TLSConfig.Clone()
 	}
 	if config.NextProtos == nil {
 		config.NextProtos = []string{"http/1.1"}
 	}
-	config.Certificates = make([]tls.Certificate, 1)
-	config.Certificates[0], err = tls.LoadX509KeyPair(cert, key)
-	if err != nil {
+	if s.certs == nil {
+		s.certs = &certStore{}
+	}
+	if err := s.certs.load(cert, key); err != nil {
 		return err
 	}
+	config.GetCertificate = s.certs.getCertificate
 
-	l, err := net.Listen("tcp", s.Addr)
+	l, err := s.listen()
 	if err != nil {
 		return err
 	}
-	tlsList := tls.NewListener(l.(*net.TCPListener), config)
+	tlsList := tls.NewListener(l, config)
 	return s.serve(tlsList)
 }
 
+func (s *server) listen() (net.Listener, error) {
+	network := s.network
+	if network == "" {
+		network = "tcp"
+	}
+	lc := net.ListenConfig{}
+	if s.reusePort {
+		lc.Control = reusePort
+	}
+	l, err := lc.Listen(context.Background(), network, s.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if s.backlog > 0 {
+		if err := setBacklog(l, s.backlog); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
 // serve hooks in the Server.ConnState to incr and decr the waitgroup based on
 // the connection state.
 func (s *server) serve(l net.Listener) error {
+	if s.maxConns > 0 {
+		l = netutil.LimitListener(l, s.maxConns)
+	}
+	s.mu.Lock()
+	s.listener = l
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+	}
+	stop := s.stop
+	s.mu.Unlock()
+
 	s.Server.ConnState = func(conn net.Conn, state http.ConnState) {
 		switch state {
 		case http.StateNew:
 			s.wg.Add(1)
+			atomic.AddInt64(&s.conns, 1)
 		case http.StateClosed, http.StateHijacked:
+			atomic.AddInt64(&s.conns, -1)
 			s.wg.Done()
 		}
 	}
-	go s.closeNotify(l)
+	s.withCancel()
+	go s.closeNotify(l, stop)
 
 	errChan := make(chan error, 1)
 	go func() {
@@ -96,16 +235,113 @@ func (s *server) serve(l net.Listener) error {
 			return err
 		case <-s.quit:
 			s.SetKeepAlivesEnabled(false)
-			s.wg.Wait()
+			s.drain()
 			return errors.New("server stopped gracefully")
 		case <-s.fquit:
 			return errors.New("server stopped: process killed")
+		case <-stop:
+			return errors.New("server stopped: shutdown")
 		}
 	}
 }
 
-func (s *server) closeNotify(l net.Listener) {
+// shutdown closes the listener and the idle connections, and waits until the
+// connections serving a request are closed or ctx is done.
+func (s *server) shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	l, stop := s.listener, s.stop
+	if l == nil {
+		s.mu.Unlock()
+		return errors.New("weavebox: server is not serving")
+	}
+	select {
+	case <-stop:
+	default:
+		l.Close()
+		s.SetKeepAlivesEnabled(false)
+		close(stop)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// withCancel derives the contexts of the requests served from a context that
+// is canceled by s.cancel.
+func (s *server) withCancel() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	base := s.Server.BaseContext
+	s.Server.BaseContext = func(l net.Listener) context.Context {
+		if base == nil {
+			return ctx
+		}
+		baseCtx, cancelBase := context.WithCancel(base(l))
+		go func() {
+			select {
+			case <-ctx.Done():
+				cancelBase()
+			case <-baseCtx.Done():
+			}
+		}()
+		return baseCtx
+	}
+}
+
+// drain waits for all connections to close, periodically reporting the number
+// of connections that remain. Connections that remain open after the timeout,
+// like streaming responses, are asked to close by canceling the context of
+// their requests. If they are still open after cancelGracePeriod they are
+// closed.
+func (s *server) drain() {
+	start := time.Now()
+	n := atomic.LoadInt64(&s.conns)
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(drainReportInterval)
+	defer ticker.Stop()
+	var timeout, closeConns <-chan time.Time
+	if s.timeout > 0 {
+		timer := time.NewTimer(s.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		select {
+		case <-done:
+			fmt.Fprintf(s.output, "drained %d connections in %s\n", n, time.Since(start))
+			return
+		case <-ticker.C:
+			fmt.Fprintf(s.output, "waiting for %d connections to drain\n", atomic.LoadInt64(&s.conns))
+		case <-timeout:
+			fmt.Fprintf(s.output, "canceling the requests of %d connections\n", atomic.LoadInt64(&s.conns))
+			s.cancel()
+			closeConns = time.After(cancelGracePeriod)
+		case <-closeConns:
+			fmt.Fprintf(s.output, "closing %d connections\n", atomic.LoadInt64(&s.conns))
+			s.Server.Close()
+			return
+		}
+	}
+}
+
+func (s *server) closeNotify(l net.Listener, stop <-chan struct{}) {
 	sig := make(chan os.Signal, 1)
+	defer signal.Stop(sig)
 
 	signal.Notify(
 		sig,
@@ -115,7 +351,12 @@ func (s *server) closeNotify(l net.Listener) {
 		syscall.SIGUSR2,
 		syscall.SIGINT,
 	)
-	sign := <-sig
+	var sign os.Signal
+	select {
+	case sign = <-sig:
+	case <-stop:
+		return
+	}
 	switch sign {
 	case syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT:
 		l.Close()
@@ -0,0 +1,436 @@
+package weavebox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServerDrain(t *testing.T) {
+	drainReportInterval = 10 * time.Millisecond
+	defer func() { drainReportInterval = time.Second }()
+
+	buf := &bytes.Buffer{}
+	srv := &server{output: buf}
+	for i := 0; i < 2; i++ {
+		srv.wg.Add(1)
+		atomic.AddInt64(&srv.conns, 1)
+	}
+	done := make(chan struct{})
+	go func() {
+		srv.drain()
+		close(done)
+	}()
+
+	time.Sleep(25 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		atomic.AddInt64(&srv.conns, -1)
+		srv.wg.Done()
+	}
+	<-done
+
+	out := buf.String()
+	if !strings.Contains(out, "waiting for 2 connections to drain") {
+		t.Errorf("expecting the remaining connections to be reported got %s", out)
+	}
+	if !strings.Contains(out, "drained 2 connections in") {
+		t.Errorf("expecting the drained connections to be reported got %s", out)
+	}
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	defer func(d time.Duration) { cancelGracePeriod = d }(cancelGracePeriod)
+	cancelGracePeriod = time.Second
+
+	started := make(chan struct{})
+	stream := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+		rw.(http.Flusher).Flush()
+		close(started)
+		<-r.Context().Done()
+	})
+	buf := &bytes.Buffer{}
+	srv := &server{
+		Server:  &http.Server{Handler: stream},
+		quit:    make(chan struct{}, 1),
+		fquit:   make(chan struct{}, 1),
+		output:  buf,
+		timeout: 20 * time.Millisecond,
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.serve(l)
+	}()
+	go func() {
+		res, err := http.Get("http://" + l.Addr().String())
+		if err == nil {
+			ioutil.ReadAll(res.Body)
+			res.Body.Close()
+		}
+	}()
+
+	<-started
+	l.Close()
+	srv.quit <- struct{}{}
+	select {
+	case err := <-errc:
+		if err == nil || !strings.Contains(err.Error(), "gracefully") {
+			t.Errorf("expecting a graceful stop got %v", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("expecting the streaming request to be canceled on shutdown")
+	}
+	if !strings.Contains(buf.String(), "canceling the requests of 1 connections") {
+		t.Errorf("expecting the cancellation to be reported got %s", buf.String())
+	}
+}
+
+func TestServerShutdownClose(t *testing.T) {
+	defer func(d time.Duration) { cancelGracePeriod = d }(cancelGracePeriod)
+	cancelGracePeriod = 10 * time.Millisecond
+
+	buf := &bytes.Buffer{}
+	srv := &server{
+		Server:  &http.Server{},
+		output:  buf,
+		timeout: 10 * time.Millisecond,
+		cancel:  func() {},
+	}
+	srv.wg.Add(1)
+	atomic.AddInt64(&srv.conns, 1)
+	srv.drain()
+	if !strings.Contains(buf.String(), "closing 1 connections") {
+		t.Errorf("expecting the connections to be closed got %s", buf.String())
+	}
+}
+
+func TestServerMaxConnections(t *testing.T) {
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("ok"))
+	})
+	srv := &server{
+		Server:   &http.Server{Handler: h},
+		quit:     make(chan struct{}, 1),
+		fquit:    make(chan struct{}, 1),
+		output:   ioutil.Discard,
+		timeout:  10 * time.Millisecond,
+		maxConns: 1,
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.serve(l)
+	defer func() {
+		l.Close()
+		srv.quit <- struct{}{}
+	}()
+
+	idle, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		if res, err := client.Get("http://" + l.Addr().String()); err == nil {
+			res.Body.Close()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("expecting the connection to wait while the limit is reached")
+	case <-time.After(50 * time.Millisecond):
+	}
+	idle.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expecting the connection to be accepted once a connection closed")
+	}
+}
+
+func TestNewServerTimeouts(t *testing.T) {
+	w := New()
+	srv := newServer(":0", w)
+	if srv.ReadTimeout != 5*time.Second || srv.WriteTimeout != 10*time.Second || srv.IdleTimeout != 0 {
+		t.Errorf("expecting the default timeouts got %s %s %s", srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+
+	w.ReadTimeout = time.Minute
+	w.WriteTimeout = -1
+	w.IdleTimeout = 2 * time.Minute
+	srv = newServer(":0", w)
+	if srv.ReadTimeout != time.Minute || srv.WriteTimeout != 0 || srv.IdleTimeout != 2*time.Minute {
+		t.Errorf("expecting the configured timeouts got %s %s %s", srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+
+	w.IdleTimeout = -1
+	if srv = newServer(":0", w); srv.IdleTimeout != math.MaxInt64 {
+		t.Errorf("expecting the idle timeout to be disabled got %s", srv.IdleTimeout)
+	}
+}
+
+func TestServerIdleTimeoutDisabled(t *testing.T) {
+	w := New()
+	w.ReadTimeout = 50 * time.Millisecond
+	w.IdleTimeout = -1
+	w.Get("/", noopHandler)
+	ts := httptest.NewUnstartedServer(w)
+	ts.Config = newServer("", w)
+	ts.Start()
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			// idle for longer than the ReadTimeout.
+			time.Sleep(150 * time.Millisecond)
+		}
+		fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+		res, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("request %d: expecting the idle connection to stay open got %v", i+1, err)
+		}
+		res.Body.Close()
+	}
+}
+
+func TestServerListenNetwork(t *testing.T) {
+	srv := &server{Server: &http.Server{Addr: "127.0.0.1:0"}, network: "tcp4"}
+	l, err := srv.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	srv.network = "tcp6"
+	if l, err := srv.listen(); err == nil {
+		l.Close()
+		t.Error("expecting an IPv4 address not to be bound with tcp6")
+	}
+}
+
+func TestServeTLSUnixNetwork(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := writeTestCertificate(t, dir, "unix")
+	sock := filepath.Join(dir, "weavebox.sock")
+
+	w := New()
+	w.Output = ioutil.Discard
+	w.Network = "unix"
+	w.Get("/", noopHandler)
+	go w.ServeCustomTLS(&http.Server{Addr: sock, Handler: w}, cert, key)
+	defer w.Shutdown(context.Background())
+	listenAddr(w)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	res, err := client.Get("https://weavebox/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	isHTTPStatusOK(t, res.StatusCode)
+}
+
+func TestReloadCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "weavebox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := New()
+	srv := &server{certs: w.certs}
+	cert, key := writeTestCertificate(t, dir, "old")
+	if err := srv.certs.load(cert, key); err != nil {
+		t.Fatal(err)
+	}
+	expectCertificate(t, srv.certs, "old")
+
+	cert, key = writeTestCertificate(t, dir, "new")
+	if err := w.Box("/sub").ReloadCertificate(cert, key); err != nil {
+		t.Fatal(err)
+	}
+	expectCertificate(t, srv.certs, "new")
+
+	if err := w.ReloadCertificate(filepath.Join(dir, "missing.pem"), key); err == nil {
+		t.Error("expecting an error for a missing certificate")
+	}
+	expectCertificate(t, srv.certs, "new")
+}
+
+func expectCertificate(t *testing.T, certs *certStore, name string) {
+	cert, err := certs.getCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.Subject.CommonName != name {
+		t.Errorf("expecting certificate %s got %s", name, leaf.Subject.CommonName)
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate with the common name
+// name and its key to dir.
+func writeTestCertificate(t *testing.T, dir, name string) (string, string) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+".key")
+	pemCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(certFile, pemCert, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pemKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestWeaveboxShutdown(t *testing.T) {
+	w := New()
+	w.Output = ioutil.Discard
+	if err := w.Shutdown(context.Background()); err == nil {
+		t.Error("expecting an error when the server is not serving")
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	w.Get("/", func(ctx *Context) error {
+		close(started)
+		<-release
+		return ctx.Text(http.StatusOK, "done")
+	})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- w.ServeCustom(&http.Server{Addr: "127.0.0.1:0", Handler: w})
+	}()
+	addr := listenAddr(w)
+	body := make(chan string, 1)
+	go func() {
+		res, err := http.Get("http://" + addr)
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		b, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		body <- string(b)
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := w.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expecting the deadline to be exceeded got %v", err)
+	}
+	select {
+	case err := <-errc:
+		if err == nil || !strings.Contains(err.Error(), "shutdown") {
+			t.Errorf("expecting Serve to return on shutdown got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expecting Serve to return on shutdown")
+	}
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Error("expecting new connections to be refused")
+	}
+
+	close(release)
+	if err := w.Shutdown(context.Background()); err != nil {
+		t.Errorf("expecting the requests to drain got %v", err)
+	}
+	if b := <-body; b != "done" {
+		t.Errorf("expecting the request being served to finish got %s", b)
+	}
+}
+
+// listenAddr waits until w is serving and returns the address it listens on.
+func listenAddr(w *Weavebox) string {
+	for {
+		if srv, ok := w.running.Load().(*server); ok {
+			srv.mu.Lock()
+			l := srv.listener
+			srv.mu.Unlock()
+			if l != nil {
+				return l.Addr().String()
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestServeCustomKeepAlives(t *testing.T) {
+	w := New()
+	w.Output = ioutil.Discard
+	w.Get("/", noopHandler)
+	s := &http.Server{Addr: "127.0.0.1:0", Handler: w}
+	s.SetKeepAlivesEnabled(false)
+	go w.ServeCustom(s)
+	defer w.Shutdown(context.Background())
+
+	res, err := http.Get("http://" + listenAddr(w))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if !res.Close {
+		t.Error("expecting keep-alives disabled on the custom server to stay disabled")
+	}
+}
@@ -0,0 +1,76 @@
+package weavebox
+
+import (
+	"bytes"
+	"net/http"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// SingleFlight returns a Handler that coalesces concurrent requests with the
+// same key, as returned by keyFn. Only one execution of h runs per key at a
+// time, its response is buffered and written to all the requests that waited
+// for it. If h returns an error, nothing is written and the error is returned
+// for each of the waiting requests, to be handled by their ErrorHandler.
+// Requests with an empty key are not coalesced.
+// 	app.Get("/report", weavebox.SingleFlight(func(ctx *weavebox.Context) string {
+// 		return ctx.Request().URL.RequestURI()
+// 	}, renderReport))
+func SingleFlight(keyFn func(*Context) string, h Handler) Handler {
+	group := &singleflight.Group{}
+	return func(ctx *Context) error {
+		key := keyFn(ctx)
+		if key == "" {
+			return h(ctx)
+		}
+		v, err, _ := group.Do(key, func() (interface{}, error) {
+			buf := newResponseBuffer()
+			res := ctx.response
+			ctx.response = &responseWriter{w: buf, route: res.route}
+			defer func() { ctx.response = res }()
+			if err := h(ctx); err != nil {
+				return nil, err
+			}
+			ctx.response.writePendingStatus()
+			return buf, nil
+		})
+		if err != nil {
+			return err
+		}
+		return v.(*responseBuffer).writeTo(ctx.Response())
+	}
+}
+
+// responseBuffer is a ResponseWriter that buffers the response, so it can be
+// written to other ResponseWriters.
+type responseBuffer struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: http.Header{}, code: http.StatusOK}
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) WriteHeader(code int) {
+	b.code = code
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+// writeTo writes the buffered header, status and body to rw.
+func (b *responseBuffer) writeTo(rw http.ResponseWriter) error {
+	for k, v := range b.header {
+		rw.Header()[k] = append([]string(nil), v...)
+	}
+	rw.WriteHeader(b.code)
+	_, err := rw.Write(b.body.Bytes())
+	return err
+}
@@ -0,0 +1,71 @@
+package weavebox
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSingleFlight(t *testing.T) {
+	var (
+		calls   int32
+		release = make(chan struct{})
+	)
+	w := New()
+	key := func(ctx *Context) string { return ctx.Request().URL.Path }
+	w.Get("/report", SingleFlight(key, func(ctx *Context) error {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		ctx.Response().Header().Set("X-Report", "1")
+		return ctx.Text(http.StatusAccepted, "report")
+	}))
+	w.Get("/fail", SingleFlight(key, func(ctx *Context) error {
+		return NewHTTPError(http.StatusBadGateway, "upstream failed")
+	}))
+
+	var wg sync.WaitGroup
+	recorders := make([]*httptest.ResponseRecorder, 5)
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rw *httptest.ResponseRecorder) {
+			defer wg.Done()
+			r, _ := http.NewRequest("GET", "/report", nil)
+			w.ServeHTTP(rw, r)
+		}(recorders[i])
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("expecting the handler to run once got %d", n)
+	}
+	for _, rw := range recorders {
+		if rw.Code != http.StatusAccepted || rw.Body.String() != "report" || rw.Header().Get("X-Report") != "1" {
+			t.Errorf("expecting the shared response got %d %s %v", rw.Code, rw.Body.String(), rw.Header())
+		}
+	}
+
+	code, body := doRequest(t, "GET", "/fail", nil, w)
+	if code != http.StatusBadGateway || body != "upstream failed\n" {
+		t.Errorf("expecting the error to be handled got %d %s", code, body)
+	}
+}
+
+func TestSingleFlightEmptyKey(t *testing.T) {
+	var calls int32
+	w := New()
+	w.Get("/", SingleFlight(func(ctx *Context) string { return "" }, func(ctx *Context) error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("oops")
+	}))
+	code, _ := doRequest(t, "GET", "/", nil, w)
+	if code != http.StatusInternalServerError || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("expecting the handler to run uncoalesced got %d after %d calls", code, calls)
+	}
+}
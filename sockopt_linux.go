@@ -0,0 +1,7 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le && !sparc64
+
+package weavebox
+
+// soReusePort is SO_REUSEPORT, which the syscall package does not define for
+// linux.
+const soReusePort = 0xf
@@ -0,0 +1,7 @@
+//go:build linux && (mips || mipsle || mips64 || mips64le || sparc64)
+
+package weavebox
+
+// soReusePort is SO_REUSEPORT on the architectures that number the socket
+// options like SunOS does.
+const soReusePort = 0x200
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package weavebox
+
+import (
+	"net"
+	"syscall"
+)
+
+func reusePort(network, address string, c syscall.RawConn) error {
+	return errUnsupportedSocketOption
+}
+
+func setBacklog(l net.Listener, backlog int) error {
+	return errUnsupportedSocketOption
+}
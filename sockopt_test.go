@@ -0,0 +1,30 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package weavebox
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestServerReusePort(t *testing.T) {
+	srv := &server{Server: &http.Server{Addr: "127.0.0.1:0"}, reusePort: true, backlog: 16}
+	l, err := srv.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	srv.Addr = l.Addr().String()
+	l2, err := srv.listen()
+	if err != nil {
+		t.Fatalf("expecting the port to be bound twice with SO_REUSEPORT got %v", err)
+	}
+	l2.Close()
+
+	srv.reusePort = false
+	if l2, err := srv.listen(); err == nil {
+		l2.Close()
+		t.Error("expecting the port not to be bound twice without SO_REUSEPORT")
+	}
+}
@@ -0,0 +1,39 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package weavebox
+
+import (
+	"net"
+	"syscall"
+)
+
+// reusePort sets SO_REUSEPORT on the socket before it is bound, so multiple
+// processes can listen on the same port.
+func reusePort(network, address string, c syscall.RawConn) error {
+	var err error
+	if cerr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+	}); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// setBacklog sets the size of the queue of connections waiting to be
+// accepted by listening on the socket again.
+func setBacklog(l net.Listener, backlog int) error {
+	sc, ok := l.(syscall.Conn)
+	if !ok {
+		return errUnsupportedSocketOption
+	}
+	c, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	if cerr := c.Control(func(fd uintptr) {
+		err = syscall.Listen(int(fd), backlog)
+	}); cerr != nil {
+		return cerr
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package weavebox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SSEvent sends a server-sent event with the given name and data, JSON
+// encoded, and flushes it to the client. The first event writes the status,
+// 200 unless set with SetStatus, and the text/event-stream content type. An
+// empty event name sends the data as a message event. It returns an error if
+// the underlying ResponseWriter does not implement http.Flusher, in which case
+// nothing is written. Handlers send events until the request is canceled.
+// 	for {
+// 		select {
+// 		case <-ctx.Request().Context().Done():
+// 			return nil
+// 		case stats := <-updates:
+// 			if err := ctx.SSEvent("stats", stats); err != nil {
+// 				return err
+// 			}
+// 		}
+// 	}
+func (c *Context) SSEvent(event string, data interface{}) error {
+	if _, ok := c.response.w.(http.Flusher); !ok {
+		return errors.New("response does not implement http.Flusher")
+	}
+	if strings.ContainsAny(event, "\r\n") {
+		return fmt.Errorf("invalid event name %q", event)
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if !c.response.Written() {
+		header := c.Response().Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		c.response.WriteHeader(c.response.Status())
+	}
+	frame := make([]byte, 0, len(event)+len(b)+16)
+	if event != "" {
+		frame = append(frame, "event: "+event+"\n"...)
+	}
+	frame = append(frame, "data: "...)
+	frame = append(frame, b...)
+	frame = append(frame, "\n\n"...)
+	if _, err := c.response.Write(frame); err != nil {
+		return err
+	}
+	return c.Flush()
+}
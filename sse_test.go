@@ -0,0 +1,71 @@
+package weavebox
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContextSSEvent(t *testing.T) {
+	w := New()
+	w.Get("/events", func(ctx *Context) error {
+		if err := ctx.SSEvent("stats", map[string]int{"users": 3}); err != nil {
+			return err
+		}
+		if err := ctx.SSEvent("", "hello"); err != nil {
+			return err
+		}
+		return ctx.SSEvent("bad\nname", nil)
+	})
+	w.Get("/unsupported", func(ctx *Context) error {
+		if err := ctx.SSEvent("stats", 1); err == nil {
+			t.Error("expecting an error for a ResponseWriter without http.Flusher")
+		}
+		return nil
+	})
+	srv := httptest.NewServer(w)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	isHTTPStatusOK(t, res.StatusCode)
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expecting content type text/event-stream got %s", ct)
+	}
+	if cc := res.Header.Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("expecting Cache-Control no-cache got %s", cc)
+	}
+
+	var frames []string
+	var frame []string
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			frames = append(frames, strings.Join(frame, "|"))
+			frame = nil
+			continue
+		}
+		frame = append(frame, scanner.Text())
+	}
+	expected := []string{`event: stats|data: {"users":3}`, `data: "hello"`}
+	if len(frames) != len(expected) {
+		t.Fatalf("expecting %d frames got %q", len(expected), frames)
+	}
+	for i := range expected {
+		if frames[i] != expected[i] {
+			t.Errorf("expecting frame %s got %s", expected[i], frames[i])
+		}
+	}
+
+	r, _ := http.NewRequest("GET", "/unsupported", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(struct{ http.ResponseWriter }{rw}, r)
+	if rw.Body.Len() != 0 {
+		t.Errorf("expecting nothing to be written got %q", rw.Body.String())
+	}
+}
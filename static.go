@@ -0,0 +1,196 @@
+package weavebox
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// precompressed lists the encodings of the sidecar files served by Static in
+// order of preference, together with their file extension.
+var precompressed = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// staticHandle serves the files of fs like http.FileServer does. If the client
+// accepts it and a pre-compressed sidecar of the requested file exists, the
+// sidecar is served with the Content-Type of the original file.
+func staticHandle(fs http.FileSystem) httprouter.Handle {
+	fileServer := http.FileServer(fs)
+	return func(rw http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		name := params.ByName("filepath")
+		rw.Header().Add("Vary", "Accept-Encoding")
+		for _, p := range precompressed {
+			if acceptsEncoding(r, p.encoding) && serveSidecar(rw, r, fs, name, p.encoding, p.ext) {
+				return
+			}
+		}
+		if f, err := fs.Open(name); err == nil {
+			if fi, err := f.Stat(); err == nil && !fi.IsDir() {
+				rw.Header().Set("ETag", etag(fi, ""))
+			}
+			f.Close()
+		}
+		r.URL.Path = name
+		fileServer.ServeHTTP(rw, r)
+	}
+}
+
+// serveSidecar serves the sidecar of name with the given extension. It reports
+// false if there is no such file.
+func serveSidecar(rw http.ResponseWriter, r *http.Request, fs http.FileSystem, name, encoding, ext string) bool {
+	f, err := fs.Open(name + ext)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		return false
+	}
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	rw.Header().Set("Content-Type", contentType)
+	rw.Header().Set("Content-Encoding", encoding)
+	rw.Header().Set("ETag", etag(fi, encoding))
+	http.ServeContent(rw, r, name, fi.ModTime(), f)
+	return true
+}
+
+// SPA returns a handler for single page apps that serves the files of dir, and
+// the index file for all other GET and HEAD requests, so the app can route them
+// on the client. Requests for missing files with an extension, like a stale
+// script, are answered with 404. It is set as the NotFound handler, API routes
+// are registered on a Box in API mode, whose unmatched paths keep answering
+// with a JSON 404.
+// 	api := app.Box("/api")
+// 	api.SetAPIMode(true)
+// 	api.Get("/users/:id", getUser)
+// 	app.SetNotFound(weavebox.SPA("./dist", "index.html"))
+func SPA(dir, index string) http.Handler {
+	fs := http.Dir(dir)
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			http.NotFound(rw, r)
+			return
+		}
+		name := path.Clean("/" + r.URL.Path)
+		if serveFile(rw, r, fs, name) {
+			return
+		}
+		if path.Ext(name) != "" {
+			http.NotFound(rw, r)
+			return
+		}
+		// the index changes with every deploy, it is revalidated on each
+		// request.
+		rw.Header().Set("Cache-Control", "no-cache")
+		if !serveFile(rw, r, fs, "/"+index) {
+			http.NotFound(rw, r)
+		}
+	})
+}
+
+// serveFile serves the file of fs with the given name. It reports false if
+// there is no such file.
+func serveFile(rw http.ResponseWriter, r *http.Request, fs http.FileSystem, name string) bool {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		return false
+	}
+	rw.Header().Set("ETag", etag(fi, ""))
+	http.ServeContent(rw, r, name, fi.ModTime(), f)
+	return true
+}
+
+// etag returns a strong validator for the content of a file, derived from its
+// modification time and size, and the encoding it is served with.
+func etag(fi os.FileInfo, encoding string) string {
+	if encoding != "" {
+		encoding = "-" + encoding
+	}
+	return fmt.Sprintf(`"%x-%x%s"`, fi.ModTime().UnixNano(), fi.Size(), encoding)
+}
+
+// ServeContent replies with the content read from the ReadSeeker, like
+// http.ServeContent does. Range requests are answered with 206 Partial
+// Content, which lets clients seek in large files like videos, and
+// conditional requests with If-Modified-Since and If-Range are honored. The
+// Content-Type is derived from the extension of name, or sniffed from the
+// content, unless it is already set.
+// 	f, err := os.Open(video.Path)
+// 	if err != nil {
+// 		return err
+// 	}
+// 	defer f.Close()
+// 	return ctx.ServeContent(video.Name, video.UpdatedAt, f)
+func (c *Context) ServeContent(name string, modtime time.Time, content io.ReadSeeker) error {
+	http.ServeContent(c.Response(), c.request, name, modtime, content)
+	return nil
+}
+
+// File replies with the contents of the file at path, like Static does for
+// the files of a directory. Range and conditional requests are honored. A
+// missing file results in a 404 HTTPError, so it is passed to the
+// ErrorHandler like any other error of the handler.
+// 	app.Get("/invoices/:id", func(ctx *weavebox.Context) error {
+// 		invoice, err := findInvoice(ctx.User(), ctx.Param("id"))
+// 		if err != nil {
+// 			return err
+// 		}
+// 		return ctx.File(invoice.Path)
+// 	})
+func (c *Context) File(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewHTTPError(http.StatusNotFound)
+		}
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return NewHTTPError(http.StatusNotFound)
+	}
+	c.Response().Header().Set("ETag", etag(fi, ""))
+	http.ServeContent(c.Response(), c.request, fi.Name(), fi.ModTime(), f)
+	return nil
+}
+
+// Attachment replies with the file at path like File does, and asks the
+// client to download it as filename with a Content-Disposition header. If
+// filename is empty, the base name of path is used.
+// 	return ctx.Attachment(report.Path, "report-2016.pdf")
+func (c *Context) Attachment(path, filename string) error {
+	if filename == "" {
+		filename = filepath.Base(path)
+	}
+	c.Response().Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	if err := c.File(path); err != nil {
+		c.Response().Header().Del("Content-Disposition")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package weavebox
+
+import (
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaticPrecompressed(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.js":    "plain",
+		"app.js.gz": "gzipped",
+		"app.js.br": "brotli",
+		"app.css":   "css",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w := New()
+	w.Static("/assets", dir)
+
+	tests := []struct {
+		path, accept, body, encoding string
+	}{
+		{"/assets/app.js", "", "plain", ""},
+		{"/assets/app.js", "gzip, deflate", "gzipped", "gzip"},
+		{"/assets/app.js", "gzip, br", "brotli", "br"},
+		{"/assets/app.js", "gzip, br;q=0", "gzipped", "gzip"},
+		{"/assets/app.css", "gzip, br", "css", ""},
+	}
+	etags := map[string]bool{}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		r.Header.Set("Accept-Encoding", test.accept)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		isHTTPStatusOK(t, rw.Code)
+		if rw.Body.String() != test.body {
+			t.Errorf("%s %q: expecting body %s got %s", test.path, test.accept, test.body, rw.Body.String())
+		}
+		if enc := rw.Header().Get("Content-Encoding"); enc != test.encoding {
+			t.Errorf("%s %q: expecting encoding %q got %q", test.path, test.accept, test.encoding, enc)
+		}
+		if ct := rw.Header().Get("Content-Type"); test.path == "/assets/app.js" && ct != mime.TypeByExtension(".js") {
+			t.Errorf("%s %q: expecting content type %s got %s", test.path, test.accept, mime.TypeByExtension(".js"), ct)
+		}
+		if test.path == "/assets/app.js" {
+			etags[rw.Header().Get("ETag")] = true
+		}
+	}
+	if len(etags) != 3 {
+		t.Errorf("expecting a distinct ETag for each variant got %v", etags)
+	}
+
+	r, _ := http.NewRequest("GET", "/assets/app.js", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	r, _ = http.NewRequest("GET", "/assets/app.js", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("If-None-Match", rw.Header().Get("ETag"))
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusNotModified {
+		t.Errorf("expecting code 304 got %d", rw.Code)
+	}
+}
+
+func TestContextServeContent(t *testing.T) {
+	modtime := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := New()
+	w.Get("/video", func(ctx *Context) error {
+		return ctx.ServeContent("video.txt", modtime, strings.NewReader("0123456789"))
+	})
+
+	r, _ := http.NewRequest("GET", "/video", nil)
+	r.Header.Set("Range", "bytes=2-5")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusPartialContent {
+		t.Errorf("expecting code 206 got %d", rw.Code)
+	}
+	if rw.Body.String() != "2345" {
+		t.Errorf("expecting 2345 got %s", rw.Body.String())
+	}
+	if cr := rw.Header().Get("Content-Range"); cr != "bytes 2-5/10" {
+		t.Errorf("expecting Content-Range bytes 2-5/10 got %s", cr)
+	}
+	if ct := rw.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("expecting Content-Type text/plain got %s", ct)
+	}
+
+	r, _ = http.NewRequest("GET", "/video", nil)
+	r.Header.Set("If-Modified-Since", modtime.Format(http.TimeFormat))
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusNotModified {
+		t.Errorf("expecting code 304 got %d", rw.Code)
+	}
+}
+
+func TestContextFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "report.txt")
+	if err := ioutil.WriteFile(file, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var handled error
+	w := New()
+	w.SetErrorHandler(func(ctx *Context, err error) {
+		handled = err
+		ctx.Response().WriteHeader(toHTTPError(err).Code)
+	})
+	w.Get("/file/:name", func(ctx *Context) error {
+		return ctx.File(filepath.Join(dir, ctx.Param("name")))
+	})
+	w.Get("/download/:name", func(ctx *Context) error {
+		return ctx.Attachment(filepath.Join(dir, ctx.Param("name")), "Q1 report.txt")
+	})
+
+	r, _ := http.NewRequest("GET", "/file/report.txt", nil)
+	r.Header.Set("Range", "bytes=2-5")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusPartialContent || rw.Body.String() != "2345" {
+		t.Errorf("expecting 206 2345 got %d %s", rw.Code, rw.Body.String())
+	}
+	if rw.Header().Get("Content-Disposition") != "" {
+		t.Errorf("expecting no Content-Disposition got %s", rw.Header().Get("Content-Disposition"))
+	}
+
+	r, _ = http.NewRequest("GET", "/download/report.txt", nil)
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusOK || rw.Body.String() != "0123456789" {
+		t.Errorf("expecting 200 0123456789 got %d %s", rw.Code, rw.Body.String())
+	}
+	if cd := rw.Header().Get("Content-Disposition"); cd != `attachment; filename="Q1 report.txt"` {
+		t.Errorf("expecting an attachment Content-Disposition got %s", cd)
+	}
+	if ct := rw.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("expecting Content-Type text/plain got %s", ct)
+	}
+
+	for _, path := range []string{"/file/missing.txt", "/download/missing.txt"} {
+		handled = nil
+		r, _ = http.NewRequest("GET", path, nil)
+		rw = httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if e, ok := handled.(*HTTPError); !ok || e.Code != http.StatusNotFound {
+			t.Errorf("%s: expecting a 404 HTTPError to be handled got %v", path, handled)
+		}
+		if rw.Header().Get("Content-Disposition") != "" {
+			t.Errorf("%s: expecting no Content-Disposition got %s", path, rw.Header().Get("Content-Disposition"))
+		}
+	}
+}
+
+func TestSPA(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"index.html": "<div id=app></div>",
+		"app.js":     "app()",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w := New()
+	api := w.Box("/api")
+	api.SetAPIMode(true)
+	api.Get("/users", func(ctx *Context) error {
+		return ctx.JSON(http.StatusOK, []string{"anthony"})
+	})
+	w.SetNotFound(SPA(dir, "index.html"))
+
+	tests := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{"GET", "/", http.StatusOK, "<div id=app></div>"},
+		{"GET", "/some/client/route", http.StatusOK, "<div id=app></div>"},
+		{"GET", "/app.js", http.StatusOK, "app()"},
+		{"GET", "/missing.js", http.StatusNotFound, "404 page not found"},
+		{"POST", "/some/client/route", http.StatusNotFound, "404 page not found"},
+		{"GET", "/api/users", http.StatusOK, `["anthony"]`},
+		{"GET", "/api/missing", http.StatusNotFound, `{"error":{"code":404,"message":"Not Found"}}`},
+	}
+	for _, test := range tests {
+		code, body := doRequest(t, test.method, test.path, nil, w)
+		if code != test.code || strings.TrimSpace(body) != test.body {
+			t.Errorf("%s %s: expecting %d %s got %d %s", test.method, test.path, test.code, test.body, code, body)
+		}
+	}
+}
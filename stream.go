@@ -0,0 +1,114 @@
+package weavebox
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// flushInterval is the amount of bytes written to a flushWriter before the
+// response is flushed to the client.
+const flushInterval = 4096
+
+// RenderStream calls the templateEngines Render function, writing the HTML
+// directly to the client. Rather than waiting for the whole page to render,
+// the response is flushed periodically while the template executes, which
+// improves the time to first byte of large pages. The status 200 and the HTML
+// content type are written before rendering starts.
+func (c *Context) RenderStream(name string, data interface{}) error {
+	c.Response().Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Response().WriteHeader(http.StatusOK)
+	fw := &flushWriter{w: c.response}
+	err := c.weavebox.renderer().Render(fw, name, data)
+	c.response.Flush()
+	return err
+}
+
+// Write writes p to the response body, which makes the Context an io.Writer.
+// The status is written first if it is not written yet.
+func (c *Context) Write(p []byte) (int, error) {
+	return c.response.Write(p)
+}
+
+// Flush sends the data written so far to the client. The status is written
+// first if it is not written yet. It returns an error if the underlying
+// ResponseWriter does not implement http.Flusher.
+// 	for i := 0; i < 3; i++ {
+// 		fmt.Fprintf(ctx, "step %d done\n", i)
+// 		if err := ctx.Flush(); err != nil {
+// 			return err
+// 		}
+// 	}
+func (c *Context) Flush() error {
+	f, ok := c.response.w.(http.Flusher)
+	if !ok {
+		return errors.New("response does not implement http.Flusher")
+	}
+	if !c.response.Written() {
+		c.response.WriteHeader(c.response.Status())
+	}
+	f.Flush()
+	return nil
+}
+
+// Stream writes the status and content type, and then copies r to the
+// response without buffering it in memory, like when proxying an upstream
+// response or sending data as it is generated. The data is flushed to the
+// client after each read of r when the ResponseWriter implements
+// http.Flusher. Streaming stops when the request or the Context is canceled,
+// for instance because the client disconnected, and the error of the canceled
+// context is returned.
+// 	res, err := http.Get(upstream)
+// 	if err != nil {
+// 		return err
+// 	}
+// 	defer res.Body.Close()
+// 	return ctx.Stream(res.StatusCode, res.Header.Get("Content-Type"), res.Body)
+func (c *Context) Stream(code int, contentType string, r io.Reader) error {
+	c.Response().Header().Set("Content-Type", contentType)
+	c.Response().WriteHeader(code)
+	var done <-chan struct{}
+	if c.Context != nil {
+		done = c.Context.Done()
+	}
+	buf := make([]byte, 32*1024)
+	for {
+		select {
+		case <-c.request.Context().Done():
+			return c.request.Context().Err()
+		case <-done:
+			return c.Context.Err()
+		default:
+		}
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, err := c.response.Write(buf[:n]); err != nil {
+				return err
+			}
+			c.response.Flush()
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// flushWriter flushes the underlying response each time flushInterval bytes
+// are written.
+type flushWriter struct {
+	w       *responseWriter
+	pending int
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.pending += n
+	if fw.pending >= flushInterval {
+		fw.w.Flush()
+		fw.pending = 0
+	}
+	return n, err
+}
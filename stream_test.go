@@ -0,0 +1,166 @@
+package weavebox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes []int
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushes = append(r.flushes, r.Body.Len())
+	r.ResponseRecorder.Flush()
+}
+
+type rowRenderer struct{}
+
+func (rowRenderer) Render(w io.Writer, name string, data interface{}) error {
+	for i := 0; i < data.(int); i++ {
+		io.WriteString(w, "<tr><td>"+strings.Repeat("x", 1000)+"</td></tr>\n")
+	}
+	return nil
+}
+
+func TestContextRenderStream(t *testing.T) {
+	w := New()
+	w.SetTemplateEngine(rowRenderer{})
+	w.Get("/", func(ctx *Context) error {
+		return ctx.RenderStream("table.html", 10)
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	rw := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	w.ServeHTTP(rw, r)
+
+	isHTTPStatusOK(t, rw.Code)
+	if ct := rw.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("expecting content type text/html got %s", ct)
+	}
+	if len(rw.flushes) < 3 {
+		t.Errorf("expecting the response to be flushed periodically, got %d flushes", len(rw.flushes))
+	}
+	if last := rw.flushes[len(rw.flushes)-1]; last != rw.Body.Len() {
+		t.Errorf("expecting the complete body to be flushed, flushed %d of %d", last, rw.Body.Len())
+	}
+}
+
+func TestContextFlush(t *testing.T) {
+	w := New()
+	out := &bytes.Buffer{}
+	w.Output = out
+	w.EnableAccessLog = true
+	w.Get("/progress", func(ctx *Context) error {
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(ctx, "step %d\n", i)
+			if err := ctx.Flush(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	r, _ := http.NewRequest("GET", "/progress", nil)
+	rw := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	w.ServeHTTP(rw, r)
+
+	isHTTPStatusOK(t, rw.Code)
+	if len(rw.flushes) != 3 {
+		t.Fatalf("expecting 3 flushes got %d", len(rw.flushes))
+	}
+	for i, n := range []int{7, 14, 21} {
+		if rw.flushes[i] != n {
+			t.Errorf("expecting flush %d after %d bytes got %d", i+1, n, rw.flushes[i])
+		}
+	}
+	if !strings.Contains(out.String(), `" 200 21 "/progress"`) {
+		t.Errorf("expecting the streamed response in the access-log got %s", out.String())
+	}
+
+	w.Get("/unsupported", func(ctx *Context) error {
+		if err := ctx.Flush(); err == nil {
+			t.Error("expecting an error for a ResponseWriter without http.Flusher")
+		}
+		return nil
+	})
+	r, _ = http.NewRequest("GET", "/unsupported", nil)
+	w.ServeHTTP(struct{ http.ResponseWriter }{httptest.NewRecorder()}, r)
+}
+
+// chunkReader returns its chunks one read at a time, calling onRead after each
+// read.
+type chunkReader struct {
+	chunks []string
+	onRead func()
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	if r.onRead != nil {
+		r.onRead()
+	}
+	return n, nil
+}
+
+func TestContextStream(t *testing.T) {
+	var (
+		handled error
+		cancel  context.CancelFunc
+	)
+	w := New()
+	w.SetErrorHandler(func(ctx *Context, err error) {
+		handled = err
+	})
+	w.Get("/stream", func(ctx *Context) error {
+		return ctx.Stream(http.StatusAccepted, "text/csv", &chunkReader{chunks: []string{"a,b\n", "1,2\n", "3,4\n"}})
+	})
+	w.Get("/cancel", func(ctx *Context) error {
+		return ctx.Stream(http.StatusOK, "text/plain", &chunkReader{
+			chunks: []string{"one\n", "two\n", "three\n"},
+			onRead: func() { cancel() },
+		})
+	})
+
+	r, _ := http.NewRequest("GET", "/stream", nil)
+	rw := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusAccepted {
+		t.Errorf("expecting code 202 got %d", rw.Code)
+	}
+	if ct := rw.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("expecting content type text/csv got %s", ct)
+	}
+	if rw.Body.String() != "a,b\n1,2\n3,4\n" {
+		t.Errorf("expecting the streamed body got %q", rw.Body.String())
+	}
+	if len(rw.flushes) < 3 || rw.flushes[0] != 4 {
+		t.Errorf("expecting the response to be flushed after each read got %v", rw.flushes)
+	}
+	if handled != nil {
+		t.Errorf("expecting no error got %v", handled)
+	}
+
+	var reqCtx context.Context
+	reqCtx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	r, _ = http.NewRequest("GET", "/cancel", nil)
+	r = r.WithContext(reqCtx)
+	rw = &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	w.ServeHTTP(rw, r)
+	if rw.Body.String() != "one\n" {
+		t.Errorf("expecting streaming to stop when the request is canceled got %q", rw.Body.String())
+	}
+	if handled != context.Canceled {
+		t.Errorf("expecting context.Canceled got %v", handled)
+	}
+}
@@ -4,13 +4,24 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"path"
+	"path/filepath"
+	"sync"
 	"text/template"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
 // TemplateEngine provides simple, fast and powerfull rendering of HTML pages.
 type TemplateEngine struct {
+	// Logger logs the templates that fail to parse when they are reloaded by
+	// Watch. If no Logger is set, lines are logged to os.Stderr.
+	Logger Logger
+
 	root            string
+	mu              sync.RWMutex
 	cache           map[string]*template.Template
 	templates       []string
 	templWithLayout map[string][]string
@@ -28,7 +39,10 @@ func NewTemplateEngine(root string) *TemplateEngine {
 
 // Render renders the template and satisfies the weavebox.Renderer interface.
 func (t *TemplateEngine) Render(w io.Writer, name string, data interface{}) error {
-	if templ, exist := t.cache[name]; exist {
+	t.mu.RLock()
+	templ, exist := t.cache[name]
+	t.mu.RUnlock()
+	if exist {
 		return templ.ExecuteTemplate(w, "_", data)
 	}
 	return fmt.Errorf("template %s could not be found", name)
@@ -50,33 +64,174 @@ func (t *TemplateEngine) SetTemplatesWithLayout(layout string, templates ...stri
 // Init parses all the given singel and layout templates. And stores them in the
 // template cache.
 func (t *TemplateEngine) Init() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	for layout, templates := range t.templWithLayout {
-		layout, err := ioutil.ReadFile(path.Join(t.root, layout))
-		handleErr(err)
-
 		for _, page := range templates {
-			parsedLayout, err := template.New("_").Parse(string(layout))
+			templ, err := t.parse(layout, page)
 			handleErr(err)
+			t.cache[page] = templ
+		}
+	}
 
-			templ, err := ioutil.ReadFile(path.Join(t.root, page))
-			handleErr(err)
+	for _, file := range t.templates {
+		templ, err := t.parse("", file)
+		handleErr(err)
+		t.cache[file] = templ
+	}
+}
 
-			parsedTempl, err := parsedLayout.Parse(string(templ))
-			handleErr(err)
+// watchDelay is the time Watch waits after the last change of a file before
+// it parses the templates again. Editors save a file in several steps, like a
+// truncate followed by a write, which would otherwise be parsed half-written.
+var watchDelay = 100 * time.Millisecond
 
-			t.cache[page] = parsedTempl
+// Watch starts watching the root directory of the templates in the
+// background. When a template file changes, the templates using it are parsed
+// again. A template that fails to parse is logged and the last version that
+// parsed keeps being rendered, so a typo does not stop a development server.
+// Files that are empty, like while they are being saved, are not parsed.
+// Closing the returned io.Closer stops watching.
+// 	t.Init()
+// 	watcher, err := t.Watch()
+// 	if err != nil {
+// 		log.Fatal(err)
+// 	}
+// 	defer watcher.Close()
+func (t *TemplateEngine) Watch() (io.Closer, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.Walk(t.root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return watcher.Add(p)
 		}
+		return nil
+	})
+	if err != nil {
+		watcher.Close()
+		return nil, err
 	}
+	tw := &templateWatcher{watcher: watcher, done: make(chan struct{})}
+	go t.watch(tw)
+	return tw, nil
+}
+
+// templateWatcher stops the watch of a TemplateEngine when it is closed.
+type templateWatcher struct {
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+// Close stops watching and waits until no template is being parsed anymore.
+func (tw *templateWatcher) Close() error {
+	err := tw.watcher.Close()
+	<-tw.done
+	return err
+}
 
+// watch reloads the changed files once no change was seen for watchDelay.
+func (t *TemplateEngine) watch(tw *templateWatcher) {
+	defer close(tw.done)
+	var (
+		changed = map[string]bool{}
+		timer   = time.NewTimer(watchDelay)
+	)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case event, ok := <-tw.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			if name, err := filepath.Rel(t.root, event.Name); err == nil {
+				changed[filepath.ToSlash(name)] = true
+				timer.Reset(watchDelay)
+			}
+		case <-timer.C:
+			for name := range changed {
+				t.reload(name)
+			}
+			changed = map[string]bool{}
+		case err, ok := <-tw.watcher.Errors:
+			if !ok {
+				return
+			}
+			t.logger().Error("watching templates failed", "err", err)
+		}
+	}
+}
+
+// reload parses the templates that use the file name again, name being
+// relative to the root.
+func (t *TemplateEngine) reload(name string) {
+	for layout, templates := range t.templWithLayout {
+		for _, page := range templates {
+			if name == layout || name == page {
+				t.reparse(layout, page)
+			}
+		}
+	}
 	for _, file := range t.templates {
-		templ, err := ioutil.ReadFile(path.Join(t.root, file))
-		handleErr(err)
+		if name == file {
+			t.reparse("", file)
+		}
+	}
+}
 
-		parsedTempl, err := template.New("_").Parse(string(templ))
-		handleErr(err)
+func (t *TemplateEngine) reparse(layout, page string) {
+	// an empty file is most likely being saved, the last version that parsed
+	// is kept until the content is written.
+	for _, name := range []string{layout, page} {
+		if name == "" {
+			continue
+		}
+		if fi, err := os.Stat(path.Join(t.root, name)); err == nil && fi.Size() == 0 {
+			return
+		}
+	}
+	templ, err := t.parse(layout, page)
+	if err != nil {
+		t.logger().Error("parsing template failed", "template", page, "err", err)
+		return
+	}
+	t.mu.Lock()
+	t.cache[page] = templ
+	t.mu.Unlock()
+}
+
+// parse parses page, with the given layout if layout is not empty.
+func (t *TemplateEngine) parse(layout, page string) (*template.Template, error) {
+	templ := template.New("_")
+	if layout != "" {
+		b, err := ioutil.ReadFile(path.Join(t.root, layout))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := templ.Parse(string(b)); err != nil {
+			return nil, err
+		}
+	}
+	b, err := ioutil.ReadFile(path.Join(t.root, page))
+	if err != nil {
+		return nil, err
+	}
+	return templ.Parse(string(b))
+}
 
-		t.cache[file] = parsedTempl
+func (t *TemplateEngine) logger() Logger {
+	if t.Logger != nil {
+		return t.Logger
 	}
+	return NewLogger(os.Stderr)
 }
 
 func handleErr(err error) {
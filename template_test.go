@@ -1 +1,102 @@
 package weavebox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chanWriter sends each write to the channel, for output written by
+// background goroutines.
+type chanWriter chan string
+
+func (c chanWriter) Write(p []byte) (int, error) {
+	c <- string(p)
+	return len(p), nil
+}
+
+func TestTemplateEngineReload(t *testing.T) {
+	defer func(d time.Duration) { watchDelay = d }(watchDelay)
+	watchDelay = 10 * time.Millisecond
+
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	render := func(e *TemplateEngine, name string) string {
+		buf := &bytes.Buffer{}
+		if err := e.Render(buf, name, nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	waitRender := func(e *TemplateEngine, name, expected string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for render(e, name) != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("expecting %s to be reloaded as %s got %s", name, expected, render(e, name))
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	write("layout.html", `<main>{{template "content"}}</main>`)
+	write("page.html", `{{define "content"}}page{{end}}`)
+	write("single.html", `single`)
+
+	log := make(chanWriter, 10)
+	e := NewTemplateEngine(dir)
+	e.Logger = NewLogger(log)
+	e.SetTemplates("single.html")
+	e.SetTemplatesWithLayout("layout.html", "page.html")
+	e.Init()
+	watcher, err := e.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write("layout.html", `<div>{{template "content"}}</div>`)
+	waitRender(e, "page.html", "<div>page</div>")
+
+	write("single.html", `changed`)
+	waitRender(e, "single.html", "changed")
+
+	write("single.html", `{{ .Broken`)
+	select {
+	case line := <-log:
+		if !strings.Contains(line, "level=error") || !strings.Contains(line, "template=single.html") {
+			t.Errorf("expecting the parse error to be logged got %s", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expecting the parse error to be logged")
+	}
+	if body := render(e, "single.html"); body != "changed" {
+		t.Errorf("expecting the last parsed template got %s", body)
+	}
+
+	if err := watcher.Close(); err != nil {
+		t.Fatal(err)
+	}
+	write("single.html", ``)
+	e.reload("single.html")
+	if body := render(e, "single.html"); body != "changed" {
+		t.Errorf("expecting an empty file not to be parsed got %s", body)
+	}
+
+	write("single.html", `closed`)
+	time.Sleep(5 * watchDelay)
+	if body := render(e, "single.html"); body != "changed" {
+		t.Errorf("expecting no reload after the watcher is closed got %s", body)
+	}
+}
+
+func TestTemplateEngineWatchMissingRoot(t *testing.T) {
+	e := NewTemplateEngine("does-not-exist")
+	if _, err := e.Watch(); err == nil {
+		t.Error("expecting an error watching a missing root")
+	}
+}
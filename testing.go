@@ -0,0 +1,31 @@
+package weavebox
+
+import (
+	"net/http"
+
+	"golang.org/x/net/context"
+)
+
+// NewTestContext returns a Context for the given request and response, like
+// the one a Handler is invoked with by the router, without the need of an app
+// or a listening server. The Context belongs to a new app with the default
+// configuration.
+// 	rw := httptest.NewRecorder()
+// 	r, _ := http.NewRequest("GET", "/", nil)
+// 	ctx := weavebox.NewTestContext(rw, r)
+func NewTestContext(rw http.ResponseWriter, r *http.Request) *Context {
+	return &Context{
+		Context:  context.Background(),
+		response: &responseWriter{w: rw},
+		request:  r,
+		weavebox: New(),
+	}
+}
+
+// RunMiddleware invokes the middleware h with ctx and returns its error, so a
+// middleware can be unit-tested in isolation. The error is not passed to the
+// ErrorHandler.
+// 	err := weavebox.RunMiddleware(requireAuth, weavebox.NewTestContext(rw, r))
+func RunMiddleware(h Handler, ctx *Context) error {
+	return h(ctx)
+}
@@ -0,0 +1,49 @@
+package weavebox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRunMiddleware(t *testing.T) {
+	const userKey ContextKey = "user"
+	auth := func(ctx *Context) error {
+		token, ok := ctx.BearerToken()
+		if !ok {
+			return NewHTTPError(http.StatusUnauthorized)
+		}
+		ctx.Set(userKey, token)
+		return nil
+	}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	err := RunMiddleware(auth, NewTestContext(httptest.NewRecorder(), r))
+	if e, ok := err.(*HTTPError); !ok || e.Code != http.StatusUnauthorized {
+		t.Errorf("expecting a 401 HTTPError got %v", err)
+	}
+
+	r.Header.Set("Authorization", "Bearer abc")
+	ctx := NewTestContext(httptest.NewRecorder(), r)
+	if err := RunMiddleware(auth, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Get(userKey) != "abc" {
+		t.Errorf("expecting user abc got %v", ctx.Get(userKey))
+	}
+}
+
+func TestNewTestContext(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/", nil)
+	rw := httptest.NewRecorder()
+	ctx := NewTestContext(rw, r)
+	if err := ctx.JSON(http.StatusCreated, map[string]int{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if rw.Code != http.StatusCreated {
+		t.Errorf("expecting code 201 got %d", rw.Code)
+	}
+	if ctx.Request() != r {
+		t.Error("expecting the request of the context")
+	}
+}
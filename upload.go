@@ -0,0 +1,226 @@
+package weavebox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// defaultMaxMemory is the amount of a multipart body that is kept in memory,
+// the remainder is stored on disk in temporary files.
+const defaultMaxMemory = 32 << 20
+
+// SetMaxMultipartMemory sets the amount of a multipart body kept in memory
+// while it is parsed, the remainder is stored on disk in temporary files. A
+// Box uses the value of its parent unless it is set on the box. Defaults to
+// 32MB.
+// 	imports := app.Box("/import")
+// 	imports.SetMaxMultipartMemory(100 << 20)
+func (w *Weavebox) SetMaxMultipartMemory(n int64) {
+	w.maxMultipartMemory = n
+}
+
+// multipartMemory returns the maxMultipartMemory of w or its parents.
+func (w *Weavebox) multipartMemory() int64 {
+	for ; w != nil; w = w.parent {
+		if w.maxMultipartMemory > 0 {
+			return w.maxMultipartMemory
+		}
+	}
+	return defaultMaxMemory
+}
+
+// maxMultipartSize returns the MaxMultipartSize of w or its parents.
+func (w *Weavebox) maxMultipartSize() int64 {
+	for ; w != nil; w = w.parent {
+		if w.MaxMultipartSize > 0 {
+			return w.MaxMultipartSize
+		}
+	}
+	return 0
+}
+
+// maxFileSize returns the MaxFileSize of w or its parents.
+func (w *Weavebox) maxFileSize() int64 {
+	for ; w != nil; w = w.parent {
+		if w.MaxFileSize > 0 {
+			return w.MaxFileSize
+		}
+	}
+	return 0
+}
+
+// maxFiles returns the MaxFiles of w or its parents.
+func (w *Weavebox) maxFiles() int {
+	for ; w != nil; w = w.parent {
+		if w.MaxFiles > 0 {
+			return w.MaxFiles
+		}
+	}
+	return 0
+}
+
+// FormFile returns the first file for the given form key. The upload limits
+// configured on the Weavebox are enforced when the multipart form is parsed.
+func (c *Context) FormFile(name string) (multipart.File, *multipart.FileHeader, error) {
+	if err := c.parseMultipartForm(); err != nil {
+		return nil, nil, err
+	}
+	return c.request.FormFile(name)
+}
+
+// MultipartForm returns the parsed multipart form, holding both the values and
+// the files of the request. The form is parsed once, with the upload limits
+// configured on the Weavebox, later calls and FormFile use the parsed form.
+// 	form, err := ctx.MultipartForm()
+// 	if err != nil {
+// 		return err
+// 	}
+// 	for _, fh := range form.File["photos"] {
+// 		..
+// 	}
+func (c *Context) MultipartForm() (*multipart.Form, error) {
+	if err := c.parseMultipartForm(); err != nil {
+		return nil, err
+	}
+	return c.request.MultipartForm, nil
+}
+
+// SaveUploadedFile writes the uploaded file to dst.
+func (c *Context) SaveUploadedFile(fh *multipart.FileHeader, dst string) error {
+	if max := c.weavebox.maxFileSize(); max > 0 && fh.Size > max {
+		return errFileTooLarge(fh.Filename)
+	}
+	src, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, src)
+	return err
+}
+
+// parseMultipartForm parses the multipart request body once and validates it
+// against MaxMultipartSize, MaxFileSize and MaxFiles. The limits are enforced
+// while the body is read, the parts are checked as they stream in and the
+// accepted parts are passed on to be stored like ParseMultipartForm does.
+func (c *Context) parseMultipartForm() error {
+	r := c.request
+	if r.MultipartForm != nil {
+		return nil
+	}
+	w := c.weavebox
+	if max := w.maxMultipartSize(); max > 0 {
+		if r.ContentLength > max {
+			return NewHTTPError(http.StatusRequestEntityTooLarge)
+		}
+		r.Body = http.MaxBytesReader(c.response, r.Body, max)
+	}
+	if r.Form == nil {
+		if err := r.ParseForm(); err != nil {
+			return NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	copied := make(chan error, 1)
+	go func() {
+		err := copyParts(mw, mr, w.maxFileSize(), w.maxFiles())
+		pw.CloseWithError(err)
+		copied <- err
+	}()
+	form, err := multipart.NewReader(pr, mw.Boundary()).ReadForm(w.multipartMemory())
+	// unblocks copyParts when the form failed to be read.
+	pr.Close()
+	copyErr := <-copied
+	var httpErr *HTTPError
+	if errors.As(copyErr, &httpErr) {
+		err = httpErr
+	} else if err == nil {
+		err = copyErr
+	}
+	if err != nil {
+		if form != nil {
+			form.RemoveAll()
+		}
+		var maxErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &httpErr):
+			return httpErr
+		case errors.As(err, &maxErr):
+			return NewHTTPError(http.StatusRequestEntityTooLarge)
+		}
+		return NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	r.MultipartForm = form
+	if r.PostForm == nil {
+		r.PostForm = url.Values{}
+	}
+	for k, v := range form.Value {
+		r.Form[k] = append(r.Form[k], v...)
+		r.PostForm[k] = append(r.PostForm[k], v...)
+	}
+	return nil
+}
+
+// copyParts copies the parts of src to dst, and stops at the first file that
+// exceeds maxSize bytes or exceeds maxFiles files.
+func copyParts(dst *multipart.Writer, src *multipart.Reader, maxSize int64, maxFiles int) error {
+	files := 0
+	for {
+		p, err := src.NextPart()
+		if err == io.EOF {
+			return dst.Close()
+		}
+		if err != nil {
+			return err
+		}
+		pw, err := dst.CreatePart(p.Header)
+		if err != nil {
+			return err
+		}
+		filename := p.FileName()
+		if filename == "" {
+			if _, err := io.Copy(pw, p); err != nil {
+				return err
+			}
+			continue
+		}
+		files++
+		if maxFiles > 0 && files > maxFiles {
+			return NewHTTPError(http.StatusBadRequest, fmt.Sprintf("too many files, at most %d allowed", maxFiles))
+		}
+		var part io.Reader = p
+		if maxSize > 0 {
+			part = io.LimitReader(p, maxSize+1)
+		}
+		n, err := io.Copy(pw, part)
+		if err != nil {
+			return err
+		}
+		if maxSize > 0 && n > maxSize {
+			return errFileTooLarge(filename)
+		}
+	}
+}
+
+func errFileTooLarge(name string) error {
+	return NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("file %s is too large", name))
+}
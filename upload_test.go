@@ -0,0 +1,250 @@
+package weavebox
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func multipartBody(t *testing.T, files map[string]string) (*bytes.Buffer, string) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for name, content := range files {
+		fw, err := mw.CreateFormFile(name, name+".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(content))
+	}
+	mw.Close()
+	return body, mw.FormDataContentType()
+}
+
+func doUpload(t *testing.T, w *Weavebox, files map[string]string) (int, string) {
+	body, contentType := multipartBody(t, files)
+	r, err := http.NewRequest("POST", "/upload", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", contentType)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	return rw.Code, rw.Body.String()
+}
+
+func TestFormFile(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "upload.txt")
+	w := New()
+	w.Post("/upload", func(ctx *Context) error {
+		_, fh, err := ctx.FormFile("a")
+		if err != nil {
+			return err
+		}
+		return ctx.SaveUploadedFile(fh, dst)
+	})
+	code, _ := doUpload(t, w, map[string]string{"a": "hello"})
+	isHTTPStatusOK(t, code)
+	b, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Errorf("expecting hello got %s", b)
+	}
+}
+
+func TestContextMultipartForm(t *testing.T) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	mw.WriteField("title", "holiday")
+	for _, name := range []string{"beach.jpg", "sunset.jpg"} {
+		fw, _ := mw.CreateFormFile("photos", name)
+		fw.Write([]byte(name))
+	}
+	mw.Close()
+
+	w := New()
+	w.Post("/upload", func(ctx *Context) error {
+		form, err := ctx.MultipartForm()
+		if err != nil {
+			return err
+		}
+		again, err := ctx.MultipartForm()
+		if err != nil {
+			return err
+		}
+		if again != form {
+			t.Error("expecting the parsed form to be reused")
+		}
+		if _, _, err := ctx.FormFile("photos"); err != nil {
+			return err
+		}
+		names := []string{}
+		for _, fh := range form.File["photos"] {
+			names = append(names, fh.Filename)
+		}
+		return ctx.Text(http.StatusOK, form.Value["title"][0]+": "+strings.Join(names, ", "))
+	})
+	r, _ := http.NewRequest("POST", "/upload", body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if rw.Body.String() != "holiday: beach.jpg, sunset.jpg" {
+		t.Errorf("expecting the values and files of the form got %s", rw.Body.String())
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	handler := func(ctx *Context) error {
+		_, _, err := ctx.FormFile("a")
+		return err
+	}
+	files := map[string]string{"a": "hello", "b": "world"}
+
+	w := New()
+	w.MaxFileSize = 3
+	w.Post("/upload", handler)
+	if code, _ := doUpload(t, w, files); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expecting code 413 got %d", code)
+	}
+
+	w = New()
+	w.MaxMultipartSize = 16
+	w.Post("/upload", handler)
+	if code, _ := doUpload(t, w, files); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expecting code 413 got %d", code)
+	}
+
+	w = New()
+	w.MaxFiles = 1
+	w.Post("/upload", handler)
+	code, body := doUpload(t, w, files)
+	if code != http.StatusBadRequest {
+		t.Errorf("expecting code 400 got %d", code)
+	}
+	if !strings.Contains(body, "too many files") {
+		t.Errorf("expecting body: too many files got %s", body)
+	}
+}
+
+func TestUploadLimitsBox(t *testing.T) {
+	w := New()
+	api := w.Box("/api")
+	w.MaxFileSize = 3
+	w.MaxFiles = 1
+	w.MaxMultipartSize = 1 << 10
+	api.Post("/upload", func(ctx *Context) error {
+		_, err := ctx.MultipartForm()
+		return err
+	})
+
+	upload := func(files map[string]string) int {
+		body, contentType := multipartBody(t, files)
+		r, _ := http.NewRequest("POST", "/api/upload", body)
+		r.Header.Set("Content-Type", contentType)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		return rw.Code
+	}
+	if code := upload(map[string]string{"a": "hello"}); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expecting the MaxFileSize of the parent to apply got %d", code)
+	}
+	if code := upload(map[string]string{"a": "a", "b": "b"}); code != http.StatusBadRequest {
+		t.Errorf("expecting the MaxFiles of the parent to apply got %d", code)
+	}
+	api.MaxFiles = 2
+	if code := upload(map[string]string{"a": "a", "b": "b"}); code != http.StatusOK {
+		t.Errorf("expecting the MaxFiles of the box to apply got %d", code)
+	}
+	api.MaxFileSize = 2 << 10
+	if code := upload(map[string]string{"a": strings.Repeat("x", 1<<10)}); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expecting the MaxMultipartSize of the parent to apply got %d", code)
+	}
+}
+
+// failingReader fails the test when the body is read past the part that
+// exceeds the upload limits.
+type failingReader struct {
+	t *testing.T
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	r.t.Error("expecting the body not to be read past the rejected part")
+	return 0, io.ErrUnexpectedEOF
+}
+
+func TestUploadLimitsWhileReading(t *testing.T) {
+	tests := []struct {
+		files []string
+		setup func(w *Weavebox)
+		code  int
+	}{
+		{[]string{strings.Repeat("x", 32<<10)}, func(w *Weavebox) { w.MaxFileSize = 10 }, http.StatusRequestEntityTooLarge},
+		{[]string{"a", "b", strings.Repeat("x", 32<<10)}, func(w *Weavebox) { w.MaxFiles = 2 }, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		for i, content := range test.files {
+			fw, err := mw.CreateFormFile("file", strconv.Itoa(i)+".txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write([]byte(content))
+		}
+		w := New()
+		test.setup(w)
+		w.Post("/upload", func(ctx *Context) error {
+			_, err := ctx.MultipartForm()
+			return err
+		})
+		r, _ := http.NewRequest("POST", "/upload", io.MultiReader(body, failingReader{t}))
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != test.code {
+			t.Errorf("%d files: expecting code %d got %d", len(test.files), test.code, rw.Code)
+		}
+	}
+}
+
+func TestBoxMaxMultipartMemory(t *testing.T) {
+	w := New()
+	onDisk := func(ctx *Context) error {
+		f, _, err := ctx.FormFile("a")
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, ok := f.(*os.File)
+		return ctx.Text(http.StatusOK, strconv.FormatBool(ok))
+	}
+	w.Post("/upload", onDisk)
+	imports := w.Box("/import")
+	imports.SetMaxMultipartMemory(1)
+	imports.Post("/upload", onDisk)
+	imports.Box("/bulk").Post("/upload", onDisk)
+
+	for route, expected := range map[string]string{
+		"/upload":             "false",
+		"/import/upload":      "true",
+		"/import/bulk/upload": "true",
+	} {
+		body, contentType := multipartBody(t, map[string]string{"a": "hello"})
+		r, _ := http.NewRequest("POST", route, body)
+		r.Header.Set("Content-Type", contentType)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Body.String() != expected {
+			t.Errorf("%s: expecting file on disk %s got %s", route, expected, rw.Body.String())
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package weavebox
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// StructValidator validates the values bound by Bind. Validators for packages
+// like go-playground/validator are plugged in by implementing it, returning a
+// ValidationError makes the default ErrorHandler respond 422 with the
+// messages of the fields.
+// 	type playground struct{ v *validator.Validate }
+//
+// 	func (p playground) ValidateStruct(v interface{}) error {
+// 		return p.v.Struct(v)
+// 	}
+type StructValidator interface {
+	ValidateStruct(v interface{}) error
+}
+
+// SetValidator sets the StructValidator Bind validates the bound values with.
+// Bind does not validate unless a validator is set, use TagValidator to
+// validate the validate tags of the fields. A Box uses the validator of its
+// parent unless it is set on the box.
+// 	app.SetValidator(weavebox.TagValidator{})
+// 	app.SetValidator(playground{validator.New()})
+func (w *Weavebox) SetValidator(v StructValidator) {
+	w.validator = v
+}
+
+// structValidator returns the StructValidator set on w or its parents, or nil
+// if there is none.
+func (w *Weavebox) structValidator() StructValidator {
+	for ; w != nil; w = w.parent {
+		if w.validator != nil {
+			return w.validator
+		}
+	}
+	return nil
+}
+
+// ValidationError is returned when a value fails validation. The default
+// ErrorHandler responds it as a 422 HTTPError.
+type ValidationError struct {
+	// Fields holds the message of each invalid field by its name.
+	Fields map[string]string
+}
+
+// Error satisfies the error interface
+func (e *ValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = name + " " + e.Fields[name]
+	}
+	return "validation failed: " + strings.Join(msgs, ", ")
+}
+
+// TagValidator validates the fields of a struct by the rules of their validate
+// tag, separated by commas:
+// 	required  the field must not be the zero value
+// 	min=n     strings must have at least n characters, slices and maps n
+// 	          items and numbers a value of at least n
+// 	max=n     like min, for at most n
+// 	email     the field must be a valid email address
+// Fields that are not required are only validated when they are set. Fields
+// are named in the ValidationError by their json tag, their weavebox tag or
+// their lowercased name.
+// 	type Signup struct {
+// 		Email string `json:"email" validate:"required,email"`
+// 		Name  string `json:"name" validate:"required,max=50"`
+// 		Age   int    `json:"age" validate:"min=18"`
+// 	}
+type TagValidator struct{}
+
+// ValidateStruct validates the fields of the struct v points to. Values that
+// are not a struct or a pointer to one are valid.
+func (TagValidator) ValidateStruct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := map[string]string{}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" || field.PkgPath != "" {
+			continue
+		}
+		msg, err := validateField(rv.Field(i), strings.Split(tag, ","))
+		if err != nil {
+			return fmt.Errorf("weavebox: field %s: %v", field.Name, err)
+		}
+		if msg != "" {
+			fields[fieldName(field)] = msg
+		}
+	}
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// validateField returns the message of the first rule v breaks, or an error
+// if a rule is malformed.
+func validateField(v reflect.Value, rules []string) (string, error) {
+	required := false
+	for _, rule := range rules {
+		if rule == "required" {
+			required = true
+		}
+	}
+	if v.IsZero() {
+		if required {
+			return "is required", nil
+		}
+		return "", nil
+	}
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	for _, rule := range rules {
+		name, arg := rule, ""
+		if i := strings.IndexByte(rule, '='); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+		switch name {
+		case "required":
+		case "email":
+			if v.Kind() != reflect.String {
+				return "", fmt.Errorf("email rule on %s", v.Type())
+			}
+			if addr, err := mail.ParseAddress(v.String()); err != nil || addr.Address != v.String() {
+				return "must be a valid email address", nil
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return "", fmt.Errorf("malformed %s rule %q", name, rule)
+			}
+			n, unit, ok := fieldSize(v)
+			if !ok {
+				return "", fmt.Errorf("%s rule on %s", name, v.Type())
+			}
+			if name == "min" && n < limit {
+				return "must be at least " + arg + unit, nil
+			}
+			if name == "max" && n > limit {
+				return "must be at most " + arg + unit, nil
+			}
+		default:
+			return "", fmt.Errorf("unknown validation rule %q", rule)
+		}
+	}
+	return "", nil
+}
+
+// fieldSize returns what min and max compare for v: the length of strings,
+// slices and maps, or the value of numbers, along with its unit.
+func fieldSize(v reflect.Value) (n float64, unit string, ok bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), " items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "", true
+	}
+	return 0, "", false
+}
+
+// fieldName returns the name of the field in the request body.
+func fieldName(field reflect.StructField) string {
+	for _, key := range []string{"json", "weavebox"} {
+		name := strings.Split(field.Tag.Get(key), ",")[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return strings.ToLower(field.Name)
+}
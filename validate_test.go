@@ -0,0 +1,136 @@
+package weavebox
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type validatedSignup struct {
+	Email string   `json:"email" validate:"required,email"`
+	Name  string   `json:"name,omitempty" validate:"required,min=2,max=5"`
+	Age   int      `json:"age" validate:"min=18,max=130"`
+	Tags  []string `json:"tags" validate:"max=2"`
+	Note  string   `validate:"max=3"`
+}
+
+func TestTagValidator(t *testing.T) {
+	tests := []struct {
+		v      validatedSignup
+		fields map[string]string
+	}{
+		{validatedSignup{Email: "a@b.io", Name: "ann"}, nil},
+		{validatedSignup{Email: "a@b.io", Name: "ann", Age: 30, Tags: []string{"go"}}, nil},
+		{validatedSignup{}, map[string]string{"email": "is required", "name": "is required"}},
+		{validatedSignup{Email: "anthony", Name: "a"}, map[string]string{
+			"email": "must be a valid email address",
+			"name":  "must be at least 2 characters",
+		}},
+		{validatedSignup{Email: "a@b.io", Name: "ännnnn", Age: 12, Tags: []string{"a", "b", "c"}, Note: "long"}, map[string]string{
+			"name": "must be at most 5 characters",
+			"age":  "must be at least 18",
+			"tags": "must be at most 2 items",
+			"note": "must be at most 3 characters",
+		}},
+	}
+	for i, test := range tests {
+		err := TagValidator{}.ValidateStruct(&test.v)
+		if test.fields == nil {
+			if err != nil {
+				t.Errorf("%d: expecting no error got %v", i, err)
+			}
+			continue
+		}
+		verr, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("%d: expecting a ValidationError got %v", i, err)
+			continue
+		}
+		if len(verr.Fields) != len(test.fields) {
+			t.Errorf("%d: expecting fields %v got %v", i, test.fields, verr.Fields)
+		}
+		for name, msg := range test.fields {
+			if verr.Fields[name] != msg {
+				t.Errorf("%d: expecting %s %s got %s", i, name, msg, verr.Fields[name])
+			}
+		}
+	}
+
+	bad := struct {
+		Name string `validate:"required,unique"`
+	}{"a"}
+	if err := (TagValidator{}).ValidateStruct(&bad); err == nil || !strings.Contains(err.Error(), "unknown validation rule") {
+		t.Errorf("expecting an unknown rule error got %v", err)
+	}
+}
+
+type rejectValidator struct{}
+
+func (rejectValidator) ValidateStruct(v interface{}) error {
+	return errors.New("rejected")
+}
+
+func TestBindValidation(t *testing.T) {
+	w := New()
+	w.SetValidator(TagValidator{})
+	handler := func(ctx *Context) error {
+		s := &validatedSignup{}
+		if err := ctx.Bind(s); err != nil {
+			return err
+		}
+		return ctx.Text(http.StatusOK, s.Name)
+	}
+	w.Post("/", handler)
+	api := w.Box("/api")
+	api.SetAPIMode(true)
+	api.Post("/", handler)
+	custom := w.Box("/custom")
+	custom.SetValidator(rejectValidator{})
+	custom.Post("/", handler)
+
+	tests := []struct {
+		route, body string
+		code        int
+		response    string
+	}{
+		{"/", `{"email":"a@b.io","name":"ann"}`, http.StatusOK, "ann"},
+		{"/", `{"email":"a@b.io","age":12}`, http.StatusUnprocessableEntity, "validation failed: age must be at least 18, name is required"},
+		{"/api", `{"email":"a@b.io"}`, http.StatusUnprocessableEntity, `"fields":{"name":"is required"}`},
+		{"/custom", `{"email":"a@b.io","name":"ann"}`, http.StatusInternalServerError, "rejected"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("POST", test.route, strings.NewReader(test.body))
+		r.Header.Set("Content-Type", "application/json")
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != test.code || !strings.Contains(rw.Body.String(), test.response) {
+			t.Errorf("%s %s: expecting %d %s got %d %s", test.route, test.body, test.code, test.response, rw.Code, rw.Body.String())
+		}
+	}
+}
+
+func TestBindWithoutValidator(t *testing.T) {
+	type playgroundSignup struct {
+		Name string `json:"name" validate:"required"`
+		Age  int    `json:"age" validate:"gte=1"`
+	}
+	w := New()
+	w.Post("/", func(ctx *Context) error {
+		s := &playgroundSignup{}
+		if err := ctx.Bind(s); err != nil {
+			return err
+		}
+		return ctx.Text(http.StatusOK, fmt.Sprintf("%q %d", s.Name, s.Age))
+	})
+	r, _ := http.NewRequest("POST", "/", strings.NewReader(`{"age":0}`))
+	r.Header.Set("Content-Type", "application/json")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if rw.Body.String() != `"" 0` {
+		t.Errorf("expecting the struct to be bound without validation got %s", rw.Body.String())
+	}
+}
@@ -1,14 +1,23 @@
 package weavebox
 
 import (
-	"encoding/json"
+	"bufio"
+	"bytes"
+	"encoding/xml"
 	"errors"
+	"expvar"
 	"fmt"
 	"io"
+	"math/rand"
+	"mime"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
@@ -21,7 +30,7 @@ import (
 // provides a gracefull webserver that can serve TLS encripted requests aswell.
 
 var defaultErrorHandler = func(ctx *Context, err error) {
-	http.Error(ctx.Response(), err.Error(), http.StatusInternalServerError)
+	ctx.weavebox.writeErrorPage(ctx.Response(), ctx.weavebox.errorFormatOf(ctx.request), toHTTPError(err))
 }
 
 // Weavebox first class object that is created by calling New()
@@ -32,42 +41,240 @@ type Weavebox struct {
 	// Output writes the access-log and debug parameters
 	Output io.Writer
 
+	// Logger is used by Context.Logger. If no Logger is set, lines are logged
+	// to Output in the logfmt format.
+	Logger Logger
+
+	// LogLevel is the minimum level of the lines logged to Output when no
+	// Logger is set. Defaults to LevelInfo, debug lines are discarded.
+	LogLevel Level
+
+	// RemoteAddrFunc determines the address of the client, which is used by the
+	// access-log and Context.RealIP. Behind a proxy it can read the address
+	// from a forwarded header. By default the host of RemoteAddr is used.
+	RemoteAddrFunc func(r *http.Request) string
+
+	// TrustedProxies lists the addresses or CIDR ranges of the proxies in front
+	// of the app. Forwarded headers like X-Forwarded-For, X-Real-IP and
+	// X-Forwarded-Proto are only honored for requests coming from these
+	// proxies, so clients can not spoof them.
+	TrustedProxies []string
+
 	// EnableAccessLog lets you turn of the default access-log
 	EnableAccessLog bool
 
+	// RecoverPanics recovers handlers that panic and passes a *PanicError to
+	// the ErrorHandler, which responds 500 by default. With EnableAccessLog
+	// the stack trace is written to Output.
+	RecoverPanics bool
+
+	// LogSampleRate is the fraction (0..1) of requests written to the
+	// access-log. Requests responded with a status >= 500 are always logged.
+	// The default rate of 1 logs every request.
+	LogSampleRate float64
+
 	// HTTP2 enables the HTTP2 protocol on the server. HTTP2 wil be default proto
 	// in the future. Currently browsers only supports HTTP/2 over encrypted TLS.
 	HTTP2 bool
 
-	templateEngine Renderer
-	router         *httprouter.Router
-	middleware     []Handler
-	prefix         string
-	context        context.Context
+	// ReadTimeout is the time Serve and ServeTLS give a request, including its
+	// body, to be read. Defaults to 5 seconds, a negative value disables it.
+	ReadTimeout time.Duration
+
+	// WriteTimeout is the time Serve and ServeTLS give a response to be
+	// written, from the end of reading the request headers. Defaults to 10
+	// seconds, disable it with a negative value for routes that stream large
+	// downloads or long-poll.
+	WriteTimeout time.Duration
+
+	// IdleTimeout is the time Serve and ServeTLS keep an idle keep-alive
+	// connection open. By default the ReadTimeout is used, a negative value
+	// keeps idle connections open until the client closes them.
+	IdleTimeout time.Duration
+
+	// ShutdownTimeout is the time connections are given to finish their
+	// requests when the server stops gracefully. After the timeout the request
+	// contexts are canceled, so long-lived requests like event streams can
+	// return, and the connections are closed shortly after. Zero waits until
+	// all connections are closed. Defaults to 30 seconds.
+	ShutdownTimeout time.Duration
+
+	// DisableKeepAlives makes the server close each connection after its
+	// response. Keep-alives are enabled by default.
+	DisableKeepAlives bool
+
+	// MaxConnections limits the number of connections the server accepts at
+	// the same time. New connections wait until an open connection closes.
+	// Zero means unlimited.
+	MaxConnections int
+
+	// ReusePort sets SO_REUSEPORT on the listening socket, so multiple
+	// processes can serve the same port and the kernel balances the
+	// connections between them. It is supported on Linux and the BSDs,
+	// elsewhere Serve returns an error.
+	ReusePort bool
+
+	// ListenBacklog is the size of the queue of connections waiting to be
+	// accepted. It is capped by the system, somaxconn on Linux. Zero uses the
+	// default of the system.
+	ListenBacklog int
+
+	// Network is the network the server listens on, "tcp4" for IPv4 only,
+	// "tcp6" for IPv6 only. The default "tcp" listens on both stacks. With
+	// "unix" the Addr of the server passed to ServeCustom and ServeCustomTLS
+	// is the path of the socket.
+	Network string
+
+	// MaxMultipartSize limits the total size in bytes of a multipart request
+	// body. Requests exceeding it are rejected with 413. Zero means unlimited.
+	// A box uses the limit of its parent unless it sets its own.
+	MaxMultipartSize int64
+
+	// MaxFileSize limits the size in bytes of each uploaded file. Uploads
+	// exceeding it are rejected with 413 as soon as the file is read past the
+	// limit. Zero means unlimited. A box uses the limit of its parent unless it
+	// sets its own.
+	MaxFileSize int64
+
+	// MaxFiles limits the number of files in a multipart request. Requests
+	// exceeding it are rejected with 400 once the file past the limit is
+	// read, the rest of the body is not parsed. Zero means unlimited. A box
+	// uses the limit of its parent unless it sets its own.
+	MaxFiles int
+
+	// TextNewline appends a newline to the text written by Context.Text when it
+	// does not end with one. By default the text is written as is. JSON
+	// responses always end with a newline.
+	TextNewline bool
+
+	// JSONIndent indents the JSON written by Context.JSON and Negotiate with
+	// the given string per nesting level, like "  ". By default compact JSON
+	// is written. It does not apply to an Encoder registered for
+	// "application/json".
+	JSONIndent string
+
+	// XMLHeader prepends the <?xml version="1.0" encoding="UTF-8"?>
+	// declaration to the XML written by Context.XML and Context.XMLPretty.
+	XMLHeader bool
+
+	// MaxBodySize limits the size in bytes of the request body read by the
+	// Context helpers. Larger bodies are rejected with 413. Zero means unlimited.
+	// A box uses the limit of its parent unless it sets its own.
+	MaxBodySize int64
+
+	// MaxConcurrentRequests limits the number of requests served at the same
+	// time. Requests exceeding it are rejected with 503 and a Retry-After
+	// header. Zero means unlimited.
+	MaxConcurrentRequests int
+
+	// MaxURILength limits the length of the request URI. Requests with a longer
+	// URI are rejected with 414 before routing. Zero means unlimited.
+	MaxURILength int
+
+	// StrictHost rejects HTTP/1.1 and later requests without a Host header
+	// with 400 before routing. It is off by default, so unusual clients
+	// keep working.
+	StrictHost bool
+
+	templateEngine   Renderer
+	router           *httprouter.Router
+	anyRouter        *httprouter.Router
+	middleware       *atomic.Value // []namedHandler
+	prefix           string
+	context          context.Context
+	notFound         http.Handler
+	methodNotAllowed http.Handler
+	api              bool
+	errorFormat      func(r *http.Request) Format
+	errorTemplates   map[int]string
+	stats            *expvar.Map
+	decoders         map[string]Decoder
+	encoders         map[string]Encoder
+	validator        StructValidator
+	envelope         EnvelopeFunc
+	active           int32
+	seq              uint64
+	healthChecks     []healthCheck
+	onResponse       []ResponseFunc
+	latency          *latencyStats
+	stripPrefix      string
+	routeNames       map[string]string
+	certs            *certStore
+	running          *atomic.Value // *server
+
+	// maxMultipartMemory is inherited from the parent when it is not set.
+	maxMultipartMemory int64
+
+	// parent is the Weavebox a Box is created from, nil for the root. boxes
+	// holds all the boxes created from the root and its boxes, hosts all the
+	// boxes created with Host.
+	parent *Weavebox
+	boxes  []*Weavebox
+	hosts  []*Box
+	host   string
 }
 
 // New returns a new Weavebox object
 func New() *Weavebox {
-	return &Weavebox{
+	w := &Weavebox{
 		router:          httprouter.New(),
+		anyRouter:       httprouter.New(),
 		Output:          os.Stderr,
 		ErrorHandler:    defaultErrorHandler,
 		EnableAccessLog: false,
+		LogSampleRate:   1,
+		certs:           &certStore{},
+		ShutdownTimeout: 30 * time.Second,
+		context:         context.Background(),
+		middleware:      &atomic.Value{},
+		running:         &atomic.Value{},
 	}
+	w.router.NotFound = http.HandlerFunc(w.serveNotFound)
+	w.router.MethodNotAllowed = http.HandlerFunc(w.serveMethodNotAllowed)
+	return w
 }
 
 // Serve serves the application on the given port
 func (w *Weavebox) Serve(port int) error {
-	srv := newServer(fmt.Sprintf(":%d", port), w, w.HTTP2)
+	srv := newServer(fmt.Sprintf(":%d", port), w)
 	return w.serve(srv)
 }
 
 // ServeTLS serves the application one the given port with TLS encription.
 func (w *Weavebox) ServeTLS(port int, certFile, keyFile string) error {
-	srv := newServer(fmt.Sprintf(":%d", port), w, w.HTTP2)
+	srv := newServer(fmt.Sprintf(":%d", port), w)
 	return w.serve(srv, certFile, keyFile)
 }
 
+// ReloadCertificate replaces the certificate served by ServeTLS without
+// restarting the server. New TLS connections use the new certificate, the
+// current certificate is kept if the files fail to load.
+// 	// after the certificate is renewed
+// 	if err := app.ReloadCertificate(cert, key); err != nil {
+// 		log.Println(err)
+// 	}
+func (w *Weavebox) ReloadCertificate(certFile, keyFile string) error {
+	return w.root().certs.load(certFile, keyFile)
+}
+
+// Shutdown stops the server gracefully, like the SIGTERM signal does. The
+// listener is closed, so no new connections are accepted and Serve returns,
+// and idle connections are closed. Shutdown then waits until the requests
+// being served are finished and their connections closed, or until ctx is
+// done in which case the error of ctx is returned.
+// 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// 	defer cancel()
+// 	if err := app.Shutdown(ctx); err != nil {
+// 		log.Println(err)
+// 	}
+func (w *Weavebox) Shutdown(ctx context.Context) error {
+	srv, ok := w.root().running.Load().(*server)
+	if !ok {
+		return errors.New("weavebox: server is not serving")
+	}
+	return srv.shutdown(ctx)
+}
+
 // ServeCustom serves the application with custom server configuration.
 func (w *Weavebox) ServeCustom(s *http.Server) error {
 	return w.serve(s)
@@ -80,10 +287,22 @@ func (w *Weavebox) ServeCustomTLS(s *http.Server, certFile, keyFile string) erro
 
 func (w *Weavebox) serve(s *http.Server, files ...string) error {
 	srv := &server{
-		Server: s,
-		quit:   make(chan struct{}, 1),
-		fquit:  make(chan struct{}, 1),
+		Server:    s,
+		quit:      make(chan struct{}, 1),
+		fquit:     make(chan struct{}, 1),
+		output:    w.Output,
+		network:   w.Network,
+		certs:     w.root().certs,
+		timeout:   w.ShutdownTimeout,
+		maxConns:  w.MaxConnections,
+		reusePort: w.ReusePort,
+		backlog:   w.ListenBacklog,
 	}
+	// keep-alives disabled on a custom server stay disabled.
+	if w.DisableKeepAlives {
+		s.SetKeepAlivesEnabled(false)
+	}
+	w.root().running.Store(srv)
 	if len(files) == 0 {
 		fmt.Fprintf(w.Output, "app listening on 0.0.0.0:%s\n", s.Addr)
 		return srv.ListenAndServe()
@@ -95,52 +314,132 @@ func (w *Weavebox) serve(s *http.Server, files ...string) error {
 	return errors.New("invalid server configuration")
 }
 
-// Handle adapts the usage of an http.Handler and will be invoked when
-// the router matches the prefix and request method
-func (w *Weavebox) Handle(method, path string, h http.Handler) {
+// Handle registers a route prefix and will invoke the Handler when the route
+// matches the prefix and the request METHOD is method. It registers methods
+// without a helper of their own, like the WebDAV PROPFIND. The middleware is
+// invoked for this route only, after the middleware of the box.
+// 	app.Handle("PROPFIND", "/files/*path", propfind)
+func (w *Weavebox) Handle(method, route string, h Handler, middleware ...Handler) {
+	w.add(method, route, h, middleware...)
+}
+
+// HandleHTTP adapts the usage of an http.Handler and will be invoked when
+// the router matches the prefix and request method. The handler bypasses the
+// middleware and the ErrorHandler.
+func (w *Weavebox) HandleHTTP(method, path string, h http.Handler) {
 	w.router.Handler(method, path, h)
 }
 
 // Get registers a route prefix and will invoke the Handler when the route
-// matches the prefix and the request METHOD is GET
-func (w *Weavebox) Get(route string, h Handler) {
-	w.add("GET", route, h)
+// matches the prefix and the request METHOD is GET. The middleware is invoked
+// for this route only, after the middleware of the box.
+func (w *Weavebox) Get(route string, h Handler, middleware ...Handler) {
+	w.add("GET", route, h, middleware...)
 }
 
 // Post registers a route prefix and will invoke the Handler when the route
-// matches the prefix and the request METHOD is POST
-func (w *Weavebox) Post(route string, h Handler) {
-	w.add("POST", route, h)
+// matches the prefix and the request METHOD is POST. The middleware is invoked
+// for this route only, after the middleware of the box.
+func (w *Weavebox) Post(route string, h Handler, middleware ...Handler) {
+	w.add("POST", route, h, middleware...)
 }
 
 // Put registers a route prefix and will invoke the Handler when the route
-// matches the prefix and the request METHOD is PUT
-func (w *Weavebox) Put(route string, h Handler) {
-	w.add("PUT", route, h)
+// matches the prefix and the request METHOD is PUT. The middleware is invoked
+// for this route only, after the middleware of the box.
+func (w *Weavebox) Put(route string, h Handler, middleware ...Handler) {
+	w.add("PUT", route, h, middleware...)
+}
+
+// Patch registers a route prefix and will invoke the Handler when the route
+// matches the prefix and the request METHOD is PATCH. The middleware is invoked
+// for this route only, after the middleware of the box.
+func (w *Weavebox) Patch(route string, h Handler, middleware ...Handler) {
+	w.add("PATCH", route, h, middleware...)
 }
 
 // Delete registers a route prefix and will invoke the Handler when the route
-// matches the prefix and the request METHOD is DELETE
-func (w *Weavebox) Delete(route string, h Handler) {
-	w.add("DELETE", route, h)
+// matches the prefix and the request METHOD is DELETE. The middleware is invoked
+// for this route only, after the middleware of the box.
+func (w *Weavebox) Delete(route string, h Handler, middleware ...Handler) {
+	w.add("DELETE", route, h, middleware...)
 }
 
 // Head registers a route prefix and will invoke the Handler when the route
-// matches the prefix and the request METHOD is HEAD
-func (w *Weavebox) Head(route string, h Handler) {
-	w.add("HEAD", route, h)
+// matches the prefix and the request METHOD is HEAD. The middleware is invoked
+// for this route only, after the middleware of the box.
+func (w *Weavebox) Head(route string, h Handler, middleware ...Handler) {
+	w.add("HEAD", route, h, middleware...)
 }
 
 // Options registers a route prefix and will invoke the Handler when the route
-// matches the prefix and the request METHOD is OPTIONS
-func (w *Weavebox) Options(route string, h Handler) {
-	w.add("OPTIONS", route, h)
+// matches the prefix and the request METHOD is OPTIONS. The middleware is invoked
+// for this route only, after the middleware of the box.
+func (w *Weavebox) Options(route string, h Handler, middleware ...Handler) {
+	w.add("OPTIONS", route, h, middleware...)
+}
+
+// Methods are the request methods Any registers a route for.
+var Methods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+
+// Any registers a route prefix for each of the Methods and will invoke the
+// Handler when the route matches the prefix. Unlike AnyMethod the routes are
+// regular routes, registering another handler for one of the Methods on the
+// same route panics. The middleware is invoked for this route only, after the
+// middleware of the box.
+// 	app.Any("/proxy/*path", proxy)
+func (w *Weavebox) Any(route string, h Handler, middleware ...Handler) {
+	for _, method := range Methods {
+		w.add(method, route, h, middleware...)
+	}
+}
+
+// AnyMethod registers a route prefix and will invoke the Handler when the route
+// matches the prefix, whatever the request METHOD is. Routes registered for a
+// specific METHOD take precedence, the Handler is only invoked for requests
+// that would otherwise be answered with 404 Not Found or 405 Method Not
+// Allowed. The method can be inspected with ctx.Request().Method.
+// 	app.Post("/rpc", handleRPC)
+// 	app.AnyMethod("/rpc", func(ctx *weavebox.Context) error {
+// 		return ctx.Text(http.StatusMethodNotAllowed, "use POST")
+// 	})
+func (w *Weavebox) AnyMethod(route string, h Handler, middleware ...Handler) {
+	path := w.routePath(route)
+	w.anyRouter.Handle(anyMethod, path, w.makeHTTPRouterHandle(path, chain(middleware, h)))
 }
 
-// Static registers the prefix to the router and start to act as a fileserver
+// Static registers the prefix to the router and start to act as a fileserver.
+// Pre-compressed sidecar files (app.js.br, app.js.gz) are served in place of
+// the file when the client accepts their encoding.
 // 	app.Static("/public", "./assets")
 func (w *Weavebox) Static(prefix, dir string) {
-	w.router.ServeFiles(path.Join(prefix, "*filepath"), http.Dir(dir))
+	w.router.GET(path.Join(prefix, "*filepath"), staticHandle(http.Dir(dir)))
+}
+
+// Favicon serves the given icon file on /favicon.ico. The route is registered
+// on the root of the router and bypasses all middleware.
+// 	app.Favicon("./assets/favicon.ico")
+func (w *Weavebox) Favicon(file string) {
+	contentType := mime.TypeByExtension(path.Ext(file))
+	if contentType == "" {
+		contentType = "image/x-icon"
+	}
+	w.router.GET("/favicon.ico", func(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		rw.Header().Set("Content-Type", contentType)
+		rw.Header().Set("Cache-Control", "public, max-age=86400")
+		http.ServeFile(rw, r, file)
+	})
+}
+
+// RobotsTxt serves content as plain text on /robots.txt. The route is
+// registered on the root of the router and bypasses all middleware.
+// 	app.RobotsTxt("User-agent: *\nDisallow: /admin")
+func (w *Weavebox) RobotsTxt(content string) {
+	w.router.GET("/robots.txt", func(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		rw.Header().Set("Cache-Control", "public, max-age=86400")
+		io.WriteString(rw, content)
+	})
 }
 
 // BindContext lets you provide a context that will live a full http roundtrip
@@ -154,9 +453,13 @@ func (w *Weavebox) BindContext(ctx context.Context) {
 // Use appends a Handler to the box middleware. Different middleware can be set
 // for each subrouter (Box).
 func (w *Weavebox) Use(handlers ...Handler) {
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+	mw := w.loadMiddleware()
 	for _, h := range handlers {
-		w.middleware = append(w.middleware, h)
+		mw = append(mw, namedHandler{h: h, box: w})
 	}
+	w.middleware.Store(mw)
 }
 
 // Box returns a new Box that will inherit all of its parents middleware.
@@ -164,17 +467,53 @@ func (w *Weavebox) Use(handlers ...Handler) {
 func (w *Weavebox) Box(prefix string) *Box {
 	b := &Box{*w}
 	b.Weavebox.prefix += prefix
+	b.parent = w
+
+	// the box gets a middleware of its own, starting with a copy of the
+	// parent's. The atomic.Value of the parent must not be copied. The box is
+	// added to the root under the lock, changes to the middleware of the
+	// parent are propagated to it.
+	middlewareMu.Lock()
+	b.middleware = &atomic.Value{}
+	b.middleware.Store(w.loadMiddleware())
+	root := w.root()
+	root.boxes = append(root.boxes, &b.Weavebox)
+	middlewareMu.Unlock()
+
+	// inherited from the parent unless they are set on the box.
+	b.ErrorHandler = nil
+	b.templateEngine = nil
+	b.notFound = nil
+	b.methodNotAllowed = nil
+	b.decoders = nil
+	b.encoders = nil
+	b.validator = nil
+	b.envelope = nil
+	b.errorFormat = nil
+	b.errorTemplates = nil
+	b.maxMultipartMemory = 0
+	b.MaxBodySize = 0
+	b.MaxFileSize = 0
+	b.MaxFiles = 0
+	b.MaxMultipartSize = 0
+	b.boxes = nil
+	b.hosts = nil
 	return b
 }
 
-// Box act as a subrouter and wil inherit all of its parents middleware
+// Box act as a subrouter and wil inherit all of its parents middleware. The
+// ErrorHandler, template engine and NotFound and MethodNotAllowed handlers of
+// the parent are used, unless they are set on the box itself. The NotFound and
+// MethodNotAllowed handlers of a box apply to all requests under its prefix.
 type Box struct {
 	Weavebox
 }
 
 // Reset clears all middleware
 func (b *Box) Reset() *Box {
-	b.Weavebox.middleware = nil
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+	b.Weavebox.middleware.Store([]namedHandler(nil))
 	return b
 }
 
@@ -187,13 +526,73 @@ func (w *Weavebox) SetTemplateEngine(t Renderer) {
 // SetNotFound sets a custom handler that is invoked whenever the
 // router could not match a route against the request url.
 func (w *Weavebox) SetNotFound(h http.Handler) {
-	w.router.NotFound = h
+	w.notFound = h
 }
 
 // SetMethodNotAllowed sets a custom handler that is invoked whenever the router
 // could not match the method against the predefined routes.
 func (w *Weavebox) SetMethodNotAllowed(h http.Handler) {
-	w.router.MethodNotAllowed = h
+	w.methodNotAllowed = h
+}
+
+// MethodNotAllowed sets a Handler that is invoked whenever the router could
+// not match the method against the predefined routes. Unlike
+// SetMethodNotAllowed the handler gets a Context, so responses can use the
+// same helpers, middleware and ErrorHandler as the rest of the box. The
+// methods the path does allow are returned by ctx.AllowedMethods.
+// 	app.MethodNotAllowed(func(ctx *weavebox.Context) error {
+// 		return ctx.JSON(http.StatusMethodNotAllowed, map[string][]string{
+// 			"allowed": ctx.AllowedMethods(),
+// 		})
+// 	})
+func (w *Weavebox) MethodNotAllowed(h Handler) {
+	handle := w.makeHTTPRouterHandle("", h)
+	w.methodNotAllowed = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		handle(rw, r, nil)
+	})
+}
+
+// GlobalOptions sets a Handler that is invoked for OPTIONS requests on paths
+// that have no OPTIONS route registered, like CORS preflight requests. Unlike
+// SetGlobalOptions the middleware of the box is invoked, and the handler gets
+// a Context. The Allow header is set to the methods of the path. OPTIONS
+// requests are never answered with 405 Method Not Allowed.
+// 	app.GlobalOptions(weavebox.CORS(opts))
+func (w *Weavebox) GlobalOptions(h Handler) {
+	handle := w.makeHTTPRouterHandle("", h)
+	w.SetGlobalOptions(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		handle(rw, r, nil)
+	}))
+}
+
+// SetAPIMode makes the box respond errors, 404 Not Found and 405 Method Not
+// Allowed as JSON, unless an ErrorHandler or NotFound and MethodNotAllowed
+// handlers are set on the box. Boxes created from an API box are in API mode
+// as well.
+// 	v1 := app.Box("/api/v1")
+// 	v1.SetAPIMode(true)
+func (w *Weavebox) SetAPIMode(enabled bool) {
+	w.api = enabled
+}
+
+// StripPrefix removes prefix from the path of each request before it is
+// routed, for apps served under a path by a proxy. Requests outside of the
+// prefix are answered with 404 Not Found. Routes are registered without the
+// prefix. The access-log keeps the path as requested.
+// 	// the proxy forwards /service/* to the app
+// 	app.StripPrefix("/service")
+// 	app.Get("/foo", ..) => GET /service/foo
+func (w *Weavebox) StripPrefix(prefix string) {
+	w.root().stripPrefix = strings.TrimSuffix(prefix, "/")
+}
+
+// SetGlobalOptions sets a handler that is invoked for OPTIONS requests on
+// paths that have no OPTIONS route registered, like CORS preflight requests.
+// OPTIONS requests are never answered with 405 Method Not Allowed, a route
+// registered with Options always takes precedence.
+func (w *Weavebox) SetGlobalOptions(h http.Handler) {
+	w.router.HandleOPTIONS = true
+	w.router.GlobalOPTIONS = h
 }
 
 // SetErrorHandler sets a centralized errorHandler that is invoked whenever
@@ -207,65 +606,362 @@ func (w *Weavebox) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	if rw != nil {
 		rw.Header().Set("Server", "weavebox/1.0")
 	}
+	start := time.Now()
+	res := &responseWriter{w: rw, seq: atomic.AddUint64(&w.seq, 1)}
+	if len(w.onResponse) > 0 {
+		defer w.notifyResponse(r, res, start)()
+	}
+	if w.stats != nil {
+		defer w.countRequest(res)()
+	}
 	if w.EnableAccessLog {
-		start := time.Now()
-		logger := &responseLogger{w: rw}
-		w.router.ServeHTTP(logger, r)
-		w.writeLog(r, start, logger.Status(), logger.Size())
-		// saves an allocation by seperating the whole logger if log is disabled
-	} else {
-		w.router.ServeHTTP(rw, r)
+		defer func() {
+			rec := recover()
+			if rec != nil {
+				// the panic aborts the request, log it as an internal server
+				// error before it continues.
+				res.status = http.StatusInternalServerError
+				res.err = fmt.Errorf("panic: %v", rec)
+			}
+			if res.Status() >= http.StatusInternalServerError || w.sampleLog() {
+				w.writeLog(r, start, res)
+			}
+			if rec != nil {
+				panic(rec)
+			}
+		}()
+	}
+	if w.MaxConcurrentRequests > 0 {
+		defer atomic.AddInt32(&w.active, -1)
+		if atomic.AddInt32(&w.active, 1) > int32(w.MaxConcurrentRequests) {
+			res.Header().Set("Retry-After", "1")
+			http.Error(res, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	if w.StrictHost && r.Host == "" && r.ProtoAtLeast(1, 1) {
+		http.Error(res, "missing required Host header", http.StatusBadRequest)
+		return
+	}
+	if w.MaxURILength > 0 && len(requestURI(r)) > w.MaxURILength {
+		http.Error(res, http.StatusText(http.StatusRequestURITooLong), http.StatusRequestURITooLong)
+		return
+	}
+	if !validPath(r) {
+		http.Error(res, "malformed percent-encoding in request path", http.StatusBadRequest)
+		return
+	}
+	if w.stripPrefix != "" {
+		stripped, ok := stripPrefix(r, w.stripPrefix)
+		if !ok {
+			w.serveNotFound(res, r)
+			return
+		}
+		r = stripped
+	}
+	w.hostRouter(r).ServeHTTP(res, r)
+}
+
+// validPath reports whether the percent-encoding of the request path, as sent
+// by the client, is valid.
+func validPath(r *http.Request) bool {
+	p := r.URL.RawPath
+	if r.RequestURI != "" {
+		p = r.RequestURI
+		if i := strings.IndexByte(p, '?'); i >= 0 {
+			p = p[:i]
+		}
+	}
+	_, err := url.PathUnescape(p)
+	return err == nil
+}
+
+// stripPrefix returns a shallow copy of r with prefix removed from its path.
+// It reports false if the path is not prefix or below it.
+func stripPrefix(r *http.Request, prefix string) (*http.Request, bool) {
+	p, ok := trimPathPrefix(r.URL.Path, prefix)
+	if !ok {
+		return r, false
+	}
+	rp, rawOK := trimPathPrefix(r.URL.RawPath, prefix)
+	if !rawOK {
+		rp = ""
+	}
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = p
+	r2.URL.RawPath = rp
+	return r2, true
+}
+
+// trimPathPrefix removes prefix from the path p, at a segment boundary.
+func trimPathPrefix(p, prefix string) (string, bool) {
+	if !strings.HasPrefix(p, prefix) {
+		return p, false
+	}
+	p = p[len(prefix):]
+	switch {
+	case p == "":
+		return "/", true
+	case p[0] != '/':
+		return p, false
+	}
+	return p, true
+}
+
+// requestURI returns the unmodified request-target sent by the client.
+func requestURI(r *http.Request) string {
+	if r.RequestURI != "" {
+		return r.RequestURI
 	}
+	return r.URL.RequestURI()
+}
+
+func (w *Weavebox) add(method, route string, h Handler, middleware ...Handler) {
+	path := w.routePath(route)
+	w.router.Handle(method, path, w.makeHTTPRouterHandle(path, chain(middleware, h)))
 }
 
-func (w *Weavebox) add(method, route string, h Handler) {
-	path := path.Join(w.prefix, route)
-	w.router.Handle(method, path, w.makeHTTPRouterHandle(h))
+// routePath returns the path route is registered under, below the prefix of
+// the box.
+func (w *Weavebox) routePath(route string) string {
+	return path.Join(w.prefix, route)
 }
 
-func (w *Weavebox) makeHTTPRouterHandle(h Handler) httprouter.Handle {
+// chain returns a Handler that invokes the middleware followed by h. The first
+// error returned stops the chain.
+func chain(middleware []Handler, h Handler) Handler {
+	if len(middleware) == 0 {
+		return h
+	}
+	return func(ctx *Context) error {
+		for _, handler := range middleware {
+			if err := handler(ctx); err != nil {
+				return err
+			}
+		}
+		return h(ctx)
+	}
+}
+
+func (w *Weavebox) makeHTTPRouterHandle(route string, h Handler) httprouter.Handle {
 	return func(rw http.ResponseWriter, r *http.Request, params httprouter.Params) {
-		if w.context == nil {
-			w.context = context.Background()
+		res, ok := rw.(*responseWriter)
+		if !ok {
+			res = &responseWriter{w: rw}
 		}
-		ctx := &Context{
+		res.route = route
+		ctx := contextPool.Get().(*Context)
+		*ctx = Context{
 			Context:  w.context,
 			vars:     params,
-			response: rw,
+			response: res,
 			request:  r,
+			route:    route,
 			weavebox: w,
 		}
-		for _, handler := range w.middleware {
-			if err := handler(ctx); err != nil {
-				w.ErrorHandler(ctx, err)
-				return
-			}
-		}
+		w.handle(ctx, h)
+		res.writePendingStatus()
+		res.close()
+		*ctx = Context{}
+		contextPool.Put(ctx)
+	}
+}
+
+// contextPool holds the Contexts of finished requests to be reused, which
+// saves an allocation per request.
+var contextPool = sync.Pool{
+	New: func() interface{} { return &Context{} },
+}
+
+// handle invokes the middleware followed by h. The first error returned stops
+// the chain and is passed to handleError.
+func (w *Weavebox) handle(ctx *Context, h Handler) {
+	if w.root().RecoverPanics {
+		defer w.recoverPanic(ctx)
+	}
+	mw, _ := w.middleware.Load().([]namedHandler)
+	if len(mw) == 0 {
 		if err := h(ctx); err != nil {
-			w.ErrorHandler(ctx, err)
+			w.handleError(ctx, err)
+		}
+		return
+	}
+	for _, handler := range mw {
+		if err := handler.h(ctx); err != nil {
+			w.handleError(ctx, err)
 			return
 		}
 	}
+	if err := h(ctx); err != nil {
+		w.handleError(ctx, err)
+	}
 }
 
-func (w *Weavebox) writeLog(r *http.Request, start time.Time, status, size int) {
-	host, _, _ := net.SplitHostPort(r.Host)
+// handleError passes err to the ErrorHandler, unless the Handler signaled that
+// the response is already handled. Errors of clients that disconnected are
+// logged at the debug level, there is no one left to respond to.
+func (w *Weavebox) handleError(ctx *Context, err error) {
+	if err == ErrHandled {
+		return
+	}
+	if IsClientDisconnect(err) {
+		ctx.Logger().Debug("client disconnected", "error", err)
+		return
+	}
+	ctx.response.err = err
+	w.errorHandler()(ctx, err)
+}
+
+// root returns the Weavebox all boxes are created from.
+func (w *Weavebox) root() *Weavebox {
+	for w.parent != nil {
+		w = w.parent
+	}
+	return w
+}
+
+// box returns the box sharing the router of w with the longest prefix the path
+// belongs to, or w itself if the path is not under the prefix of any box.
+func (w *Weavebox) box(p string) *Weavebox {
+	match := w
+	for _, b := range w.root().boxes {
+		if b.router != w.router || len(b.prefix) <= len(match.prefix) {
+			continue
+		}
+		if p == b.prefix || strings.HasPrefix(p, strings.TrimSuffix(b.prefix, "/")+"/") {
+			match = b
+		}
+	}
+	return match
+}
+
+func (w *Weavebox) errorHandler() ErrorHandlerFunc {
+	for ; w != nil; w = w.parent {
+		if w.ErrorHandler != nil {
+			return w.ErrorHandler
+		}
+		if w.api {
+			return apiErrorHandler
+		}
+	}
+	return defaultErrorHandler
+}
+
+func (w *Weavebox) renderer() Renderer {
+	for ; w != nil; w = w.parent {
+		if w.templateEngine != nil {
+			return w.templateEngine
+		}
+	}
+	return nil
+}
+
+// serveNotFound is invoked by the router when no route matches the request.
+// The NotFound handler of the box the request path belongs to is used.
+func (w *Weavebox) serveNotFound(rw http.ResponseWriter, r *http.Request) {
+	if w.serveAnyMethod(rw, r) {
+		return
+	}
+	box := w.box(r.URL.Path)
+	for b := box; b != nil; b = b.parent {
+		if b.notFound != nil {
+			b.notFound.ServeHTTP(rw, r)
+			return
+		}
+		if b.api {
+			writeAPIError(rw, NewHTTPError(http.StatusNotFound))
+			return
+		}
+		if b.errorFormat != nil {
+			box.writeErrorPage(rw, b.errorFormat(r), NewHTTPError(http.StatusNotFound, "404 page not found"))
+			return
+		}
+	}
+	box.writeErrorPage(rw, FormatText, NewHTTPError(http.StatusNotFound, "404 page not found"))
+}
+
+// serveMethodNotAllowed is invoked by the router when the route does not
+// match the request method. The MethodNotAllowed handler of the box the
+// request path belongs to is used.
+func (w *Weavebox) serveMethodNotAllowed(rw http.ResponseWriter, r *http.Request) {
+	if w.serveAnyMethod(rw, r) {
+		return
+	}
+	box := w.box(r.URL.Path)
+	for b := box; b != nil; b = b.parent {
+		if b.methodNotAllowed != nil {
+			b.methodNotAllowed.ServeHTTP(rw, r)
+			return
+		}
+		if b.api {
+			writeAPIError(rw, NewHTTPError(http.StatusMethodNotAllowed))
+			return
+		}
+		if b.errorFormat != nil {
+			box.writeErrorPage(rw, b.errorFormat(r), NewHTTPError(http.StatusMethodNotAllowed))
+			return
+		}
+	}
+	box.writeErrorPage(rw, FormatText, NewHTTPError(http.StatusMethodNotAllowed))
+}
+
+// anyMethod is the method the routes registered with AnyMethod are stored
+// under in the anyRouter.
+const anyMethod = "*"
+
+// serveAnyMethod serves the request with the route registered with AnyMethod
+// for the request path. It reports false if there is no such route.
+func (w *Weavebox) serveAnyMethod(rw http.ResponseWriter, r *http.Request) bool {
+	handle, params, _ := w.anyRouter.Lookup(anyMethod, r.URL.Path)
+	if handle == nil {
+		return false
+	}
+	// the router sets Allow before it answers 405, the route accepts any
+	// method instead.
+	rw.Header().Del("Allow")
+	handle(rw, r, params)
+	return true
+}
+
+// sampleLog reports whether a request should be written to the access-log
+// according to LogSampleRate.
+func (w *Weavebox) sampleLog() bool {
+	return w.LogSampleRate >= 1 || rand.Float64() < w.LogSampleRate
+}
+
+func (w *Weavebox) writeLog(r *http.Request, start time.Time, res *responseWriter) {
+	host := w.remoteAddr(r)
+	if host == "" {
+		host = "-"
+	}
 	username := "-"
 	if r.URL.User != nil {
 		if name := r.URL.User.Username(); name != "" {
 			username = name
 		}
 	}
-	fmt.Fprintf(w.Output, "%s - %s [%s] \"%s %s %s\" %d %d\n",
+	route := res.route
+	if route == "" {
+		route = "-"
+	}
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %d \"%s\"",
 		host,
 		username,
 		start.Format("02/Jan/2006:15:04:05 -0700"),
 		r.Method,
 		r.RequestURI,
 		r.Proto,
-		status,
-		size,
+		res.Status(),
+		res.Size(),
+		route,
 	)
+	if res.err != nil {
+		line += fmt.Sprintf(" %q", res.err.Error())
+	}
+	fmt.Fprintln(w.Output, line)
 }
 
 // Handler is a weavebox idiom for handling http.Requests
@@ -277,17 +973,63 @@ type ErrorHandlerFunc func(ctx *Context, err error)
 
 // Context is required in each weavebox Handler and can be used to pass information
 // between requests.
+// Contexts are reused once the request is handled, a Context must not be used
+// after the Handler returned, like in a goroutine started by the Handler.
 type Context struct {
 	// Context is a idiomatic way to pass information between requests.
 	// More information about context.Context can be found here:
 	// https://godoc.org/golang.org/x/net/context
 	Context  context.Context
-	response http.ResponseWriter
+	response *responseWriter
 	request  *http.Request
 	vars     httprouter.Params
+	route    string
+	body     []byte
+	query    url.Values
+	user     interface{}
+	logger   Logger
 	weavebox *Weavebox
 }
 
+// ContextKey is the type for keys of values stored in the context.Context.
+// Using a dedicated key type avoids collisions with keys of other packages.
+// 	const userKey weavebox.ContextKey = "user"
+type ContextKey string
+
+func (k ContextKey) String() string {
+	return "weavebox context key " + string(k)
+}
+
+// Set stores the value with the given key in the context.Context, making it
+// available to the next middleware and the handler.
+func (c *Context) Set(key ContextKey, value interface{}) {
+	c.Context = context.WithValue(c.Context, key, value)
+}
+
+// Get returns the value stored in the context.Context with the given key, or
+// nil if there is no value.
+func (c *Context) Get(key ContextKey) interface{} {
+	return c.Context.Value(key)
+}
+
+// SetUser stores the authenticated user of the request, it is meant to be
+// called by authentication middleware.
+// 	user, err := users.ByToken(token)
+// 	if err != nil {
+// 		return weavebox.NewHTTPError(http.StatusUnauthorized)
+// 	}
+// 	ctx.SetUser(user)
+func (c *Context) SetUser(u interface{}) {
+	c.user = u
+}
+
+// User returns the user stored with SetUser, or nil if the request is not
+// authenticated.
+// 	user, ok := ctx.User().(*model.User)
+func (c *Context) User() interface{} {
+	return c.user
+}
+
 // Response returns a default http.ResponseWriter
 func (c *Context) Response() http.ResponseWriter {
 	return c.response
@@ -298,31 +1040,119 @@ func (c *Context) Request() *http.Request {
 	return c.request
 }
 
+// SetStatus sets the status code of the response without writing it. The status
+// is written with the first write to the body, or when the handler returns.
+// Headers can still be changed until then. WriteHeader overrules SetStatus.
+func (c *Context) SetStatus(code int) {
+	c.response.pending = code
+}
+
+// Seq returns the sequence number of the request, counting the requests
+// served by the process starting at 1. It is cheaper than a request ID and
+// easier to spot in the logs of a single instance during development.
+// 	ctx.SetLogger(ctx.Logger().With("seq", ctx.Seq()))
+func (c *Context) Seq() uint64 {
+	return c.response.seq
+}
+
+// Route returns the route pattern that matched the request.
+// 	app.Get("/users/:id", ..) => ctx.Route() == "/users/:id"
+func (c *Context) Route() string {
+	return c.route
+}
+
+// AllowedMethods returns the methods allowed on the request path when the
+// request is answered with 405 Method Not Allowed, as set in the Allow header.
+// It returns nil for requests that matched a route.
+func (c *Context) AllowedMethods() []string {
+	allow := c.Response().Header().Get("Allow")
+	if allow == "" {
+		return nil
+	}
+	methods := strings.Split(allow, ",")
+	for i, m := range methods {
+		methods[i] = strings.TrimSpace(m)
+	}
+	return methods
+}
+
 // JSON is a helper function for writing a JSON encoded representation of v to
-// the ResponseWriter.
+// the ResponseWriter with the Encoder registered for "application/json". The
+// JSON of the default encoder ends with a newline and is indented when
+// JSONIndent is set.
 func (c *Context) JSON(code int, v interface{}) error {
-	c.Response().Header().Set("Content-Type", "application/json")
+	return c.encode(code, "application/json", v)
+}
+
+// XML is a helper function for writing an XML encoded representation of v to
+// the ResponseWriter. The XML declaration is written first when XMLHeader is
+// set. Encoding errors are returned.
+func (c *Context) XML(code int, v interface{}) error {
+	return c.xml(code, v, "")
+}
+
+// XMLPretty is like XML but indents the elements by two spaces per level.
+func (c *Context) XMLPretty(code int, v interface{}) error {
+	return c.xml(code, v, "  ")
+}
+
+func (c *Context) xml(code int, v interface{}, indent string) error {
+	c.Response().Header().Set("Content-Type", "application/xml")
 	c.Response().WriteHeader(code)
-	return json.NewEncoder(c.Response()).Encode(v)
+	if c.weavebox.XMLHeader {
+		if _, err := io.WriteString(c.Response(), xml.Header); err != nil {
+			return err
+		}
+	}
+	enc := xml.NewEncoder(c.Response())
+	enc.Indent("", indent)
+	return enc.Encode(v)
+}
+
+// Created is a helper function for responding to the creation of a resource.
+// It sets the Location header to the URL of the new resource, writes the 201
+// status and encodes v as JSON.
+// 	return ctx.Created("/users/"+user.ID, user)
+func (c *Context) Created(location string, v interface{}) error {
+	c.Response().Header().Set("Location", location)
+	return c.JSON(http.StatusCreated, v)
 }
 
-// Text is a helper function for writing a text/plain string to the ResponseWriter
+// Text is a helper function for writing a text/plain string to the ResponseWriter.
+// The text is written as is, unless TextNewline is set.
 func (c *Context) Text(code int, text string) error {
+	if c.weavebox.TextNewline && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
 	c.Response().Header().Set("Content-Type", "text/plain")
 	c.Response().WriteHeader(code)
 	c.Response().Write([]byte(text))
 	return nil
 }
 
+// HTML is a helper function for writing an HTML string to the ResponseWriter.
+// It behaves like Text with the text/html content type. HTML held in a []byte
+// is written with HTML(code, string(b)). The HTML is written as is, use the
+// template engine to escape data.
+func (c *Context) HTML(code int, html string) error {
+	c.Response().Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Response().WriteHeader(code)
+	io.WriteString(c.Response(), html)
+	return nil
+}
+
 // DecodeJSON is a helper that decodes the request Body to v.
 // For a more in depth use of decoding and encoding JSON, use the std JSON package.
+// A body larger than MaxBodySize results in a 413 HTTPError. When the request
+// context has a deadline, reading the body is aborted with a 408 HTTPError
+// once it passes.
 func (c *Context) DecodeJSON(v interface{}) error {
-	return json.NewDecoder(c.Request().Body).Decode(v)
+	return c.decodeBody(defaultDecoders["application/json"], v)
 }
 
 // Render calls the templateEngines Render function
 func (c *Context) Render(name string, data interface{}) error {
-	return c.weavebox.templateEngine.Render(c.Response(), name, data)
+	return c.weavebox.renderer().Render(c.Response(), name, data)
 }
 
 // Param returns the url named parameter given in the route prefix by its name
@@ -331,10 +1161,44 @@ func (c *Context) Param(name string) string {
 	return c.vars.ByName(name)
 }
 
+// ParamAt returns the name and value of the i'th named parameter of the route,
+// in the order they appear in the route prefix. It avoids the lookup by name
+// of Param for performance sensitive handlers. Empty strings are returned if
+// i is out of range.
+// 	app.Get("/:user/:repo", ..) => ctx.ParamAt(1) == "repo", "weavebox"
+func (c *Context) ParamAt(i int) (name, value string) {
+	if i < 0 || i >= len(c.vars) {
+		return "", ""
+	}
+	return c.vars[i].Key, c.vars[i].Value
+}
+
+// ParamCount returns the number of named parameters of the route.
+func (c *Context) ParamCount() int {
+	return len(c.vars)
+}
+
+// RouterParams returns the httprouter.Params of the route, for code built
+// around httprouter. It exposes an implementation detail of weavebox and may
+// change if the router does. The params must not be modified.
+// 	app.Get("/:user/:repo", ..) => ctx.RouterParams().ByName("repo")
+func (c *Context) RouterParams() httprouter.Params {
+	return c.vars
+}
+
 // Query returns the url query parameter by its name.
 // 	app.Get("/api?limit=25", ..) => ctx.Query("limit")
 func (c *Context) Query(name string) string {
-	return c.request.URL.Query().Get(name)
+	return c.QueryValues().Get(name)
+}
+
+// QueryValues returns all the values of the URL query. The query is parsed
+// once and cached for the lifetime of the request.
+func (c *Context) QueryValues() url.Values {
+	if c.query == nil {
+		c.query = c.request.URL.Query()
+	}
+	return c.query
 }
 
 // Form returns the form parameter by its name
@@ -342,11 +1206,81 @@ func (c *Context) Form(name string) string {
 	return c.request.FormValue(name)
 }
 
+// Input returns the parameter by its name from the URL query or, when the query
+// has no value for it, from the form in the request body. The query takes
+// precedence, the first non-empty value is returned.
+// 	POST /search?q=go => ctx.Input("q") == "go"
+// 	POST /search with body q=go => ctx.Input("q") == "go"
+func (c *Context) Input(name string) string {
+	if v := c.Query(name); v != "" {
+		return v
+	}
+	return c.request.PostFormValue(name)
+}
+
 // Header returns the request header by name
 func (c *Context) Header(name string) string {
 	return c.request.Header.Get(name)
 }
 
+// Cookies returns the values of the request cookies by name. If a cookie is
+// sent more than once the first value is returned. The map is empty if the
+// request has no cookies.
+func (c *Context) Cookies() map[string]string {
+	cookies := c.request.Cookies()
+	m := make(map[string]string, len(cookies))
+	for _, cookie := range cookies {
+		if _, ok := m[cookie.Name]; !ok {
+			m[cookie.Name] = cookie.Value
+		}
+	}
+	return m
+}
+
+// Cookie returns the request cookie by name, or http.ErrNoCookie if the
+// request has no such cookie.
+func (c *Context) Cookie(name string) (*http.Cookie, error) {
+	return c.request.Cookie(name)
+}
+
+// SetCookie adds a Set-Cookie header to the response. It must be called
+// before the response is written.
+func (c *Context) SetCookie(cookie *http.Cookie) {
+	http.SetCookie(c.Response(), cookie)
+}
+
+// SetCookieValue sets a cookie for the whole site that is not readable by
+// scripts and is only sent for same-site requests and top-level navigation.
+// Over HTTPS the cookie is marked Secure. maxAge is in seconds, zero makes it
+// a session cookie and a negative maxAge deletes the cookie.
+// 	ctx.SetCookieValue("session", id, 7*24*3600)
+func (c *Context) SetCookieValue(name, value string, maxAge int) {
+	c.SetCookie(&http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// BearerToken returns the token of a "Bearer" Authorization header. ok is false
+// when the header is absent, uses another scheme or the token is malformed.
+func (c *Context) BearerToken() (token string, ok bool) {
+	const scheme = "bearer "
+	auth := strings.TrimSpace(c.request.Header.Get("Authorization"))
+	if len(auth) < len(scheme) || !strings.EqualFold(auth[:len(scheme)], scheme) {
+		return "", false
+	}
+	token = strings.TrimSpace(auth[len(scheme):])
+	if token == "" || strings.ContainsAny(token, " \t") {
+		return "", false
+	}
+	return token, true
+}
+
 // Redirect redirects the request to the provided URL with the given status code.
 func (c *Context) Redirect(url string, code int) error {
 	if code < http.StatusMultipleChoices || code > http.StatusTemporaryRedirect {
@@ -356,36 +1290,138 @@ func (c *Context) Redirect(url string, code int) error {
 	return nil
 }
 
-type responseLogger struct {
+// Error replies to the request with the given status code and message as a
+// text/plain body, just like http.Error. It returns ErrHandled so the
+// ErrorHandler will not handle the request again. Nothing is written if the
+// response header was already written.
+// 	if !authorized {
+// 		return ctx.Error(http.StatusForbidden, "access forbidden")
+// 	}
+func (c *Context) Error(code int, msg string) error {
+	if !c.response.Written() {
+		http.Error(c.response, msg, code)
+	}
+	return ErrHandled
+}
+
+// RenderAbort renders the template with the given status and returns
+// ErrHandled, so the handler chain stops and the ErrorHandler does not handle
+// the request again. The template is rendered before the status is written,
+// if it fails to render its error is returned instead and nothing is written.
+// Nothing is written either if the response header was already written.
+// 	if !user.CanEdit(doc) {
+// 		return ctx.RenderAbort(http.StatusForbidden, "errors/forbidden.html", doc)
+// 	}
+func (c *Context) RenderAbort(code int, name string, data interface{}) error {
+	if c.response.Written() {
+		return ErrHandled
+	}
+	renderer := c.weavebox.renderer()
+	if renderer == nil {
+		return errors.New("no template engine set")
+	}
+	buf := &bytes.Buffer{}
+	if err := renderer.Render(buf, name, data); err != nil {
+		return err
+	}
+	c.Response().Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Response().WriteHeader(code)
+	buf.WriteTo(c.Response())
+	return ErrHandled
+}
+
+// responseWriter wraps the http.ResponseWriter of each request and keeps
+// track of the status and the size of the written response. It also records
+// the matched route and the error returned by the handler for the access-log.
+type responseWriter struct {
 	w      http.ResponseWriter
 	status int
 	size   int
+	route  string
+	err    error
+
+	// pending is the status set by Context.SetStatus that is not written yet.
+	pending int
+	// seq is the sequence number of the request.
+	seq uint64
+	// closer is closed once the request is handled, like the writer of the
+	// Compress middleware.
+	closer io.Closer
 }
 
-func (l *responseLogger) Write(p []byte) (int, error) {
-	if l.status == 0 {
-		l.status = http.StatusOK
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(rw.Status())
 	}
-	size, err := l.w.Write(p)
-	l.size += size
+	size, err := rw.w.Write(p)
+	rw.size += size
 	return size, err
 }
 
-func (l *responseLogger) Header() http.Header {
-	return l.w.Header()
+func (rw *responseWriter) Header() http.Header {
+	return rw.w.Header()
 }
 
-func (l *responseLogger) WriteHeader(code int) {
-	l.w.WriteHeader(code)
-	l.status = code
+// WriteHeader writes the status code, subsequent calls are ignored.
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.status != 0 {
+		return
+	}
+	rw.w.WriteHeader(code)
+	rw.status = code
+}
+
+// Flush implements the http.Flusher interface if the wrapped writer does.
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements the http.Hijacker interface.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	return h.Hijack()
+}
+
+// Status returns the written status code. If nothing is written yet the pending
+// status is returned, or 200 which net/http will respond with.
+func (rw *responseWriter) Status() int {
+	if rw.status != 0 {
+		return rw.status
+	}
+	if rw.pending != 0 {
+		return rw.pending
+	}
+	return http.StatusOK
+}
+
+// writePendingStatus writes the status set by Context.SetStatus if nothing
+// is written yet.
+func (rw *responseWriter) writePendingStatus() {
+	if rw.status == 0 && rw.pending != 0 {
+		rw.WriteHeader(rw.pending)
+	}
+}
+
+// close closes the closer of the response, if any.
+func (rw *responseWriter) close() {
+	if rw.closer != nil {
+		rw.closer.Close()
+		rw.closer = nil
+	}
 }
 
-func (l *responseLogger) Status() int {
-	return l.status
+func (rw *responseWriter) Size() int {
+	return rw.size
 }
 
-func (l *responseLogger) Size() int {
-	return l.size
+// Written returns true if the response header is already written.
+func (rw *responseWriter) Written() bool {
+	return rw.status != 0
 }
 
 // Renderer renders any kind of template. Weavebox allows the use of different
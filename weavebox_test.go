@@ -2,11 +2,14 @@ package weavebox
 
 import (
 	"bytes"
+	"crypto/tls"
+	"encoding/xml"
 	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -16,10 +19,34 @@ import (
 var noopHandler = func(ctx *Context) error { return nil }
 
 func TestHandle(t *testing.T) {
+	w := New()
+	for _, method := range []string{"GET", "PUT", "POST", "DELETE", "PROPFIND"} {
+		w.Handle(method, "/", noopHandler)
+		code, _ := doRequest(t, method, "/", nil, w)
+		isHTTPStatusOK(t, code)
+	}
+
+	dav := w.Box("/dav")
+	dav.Use(func(ctx *Context) error {
+		ctx.Response().Header().Set("DAV", "1")
+		return nil
+	})
+	dav.Handle("PROPFIND", "/:file", func(ctx *Context) error {
+		return NewHTTPError(http.StatusNotFound, ctx.Param("file")+" not found")
+	})
+	r, _ := http.NewRequest("PROPFIND", "/dav/notes.txt", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusNotFound || rw.Header().Get("DAV") != "1" || !strings.Contains(rw.Body.String(), "notes.txt not found") {
+		t.Errorf("expecting the middleware and ErrorHandler to be used got %d %v %s", rw.Code, rw.Header(), rw.Body.String())
+	}
+}
+
+func TestHandleHTTP(t *testing.T) {
 	w := New()
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 	for _, method := range []string{"GET", "PUT", "POST", "DELETE"} {
-		w.Handle(method, "/", handler)
+		w.HandleHTTP(method, "/", handler)
 		code, _ := doRequest(t, method, "/", nil, w)
 		isHTTPStatusOK(t, code)
 	}
@@ -46,6 +73,13 @@ func TestMethodPut(t *testing.T) {
 	isHTTPStatusOK(t, code)
 }
 
+func TestMethodPatch(t *testing.T) {
+	w := New()
+	w.Patch("/", noopHandler)
+	code, _ := doRequest(t, "PATCH", "/", nil, w)
+	isHTTPStatusOK(t, code)
+}
+
 func TestMethodDelete(t *testing.T) {
 	w := New()
 	w.Delete("/", noopHandler)
@@ -67,6 +101,33 @@ func TestMethodOptions(t *testing.T) {
 	isHTTPStatusOK(t, code)
 }
 
+func TestAny(t *testing.T) {
+	w := New()
+	api := w.Box("/api")
+	api.Use(func(ctx *Context) error {
+		ctx.Response().Header().Set("X-Box", "1")
+		return nil
+	})
+	api.Any("/proxy/*path", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, ctx.Request().Method+" "+ctx.Param("path"))
+	}, func(ctx *Context) error {
+		ctx.Response().Header().Set("X-Route", "1")
+		return nil
+	})
+	for _, method := range Methods {
+		r, _ := http.NewRequest(method, "/api/proxy/users", nil)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		isHTTPStatusOK(t, rw.Code)
+		if rw.Header().Get("X-Box") != "1" || rw.Header().Get("X-Route") != "1" {
+			t.Errorf("%s: expecting the middleware to be invoked got %v", method, rw.Header())
+		}
+		if method != "HEAD" && rw.Body.String() != method+" /users" {
+			t.Errorf("%s: expecting %s /users got %s", method, method, rw.Body.String())
+		}
+	}
+}
+
 func TestBox(t *testing.T) {
 	w := New()
 	sr := w.Box("/foo")
@@ -75,6 +136,189 @@ func TestBox(t *testing.T) {
 	isHTTPStatusOK(t, code)
 }
 
+func TestBoxPatchOptions(t *testing.T) {
+	w := New()
+	w.Use(func(ctx *Context) error {
+		ctx.Response().Header().Set("X-Root", "1")
+		return nil
+	})
+	sr := w.Box("/foo")
+	sr.Use(func(ctx *Context) error {
+		ctx.Response().Header().Set("X-Box", "1")
+		return nil
+	})
+	sr.Patch("/bar", noopHandler)
+	sr.Options("/bar", noopHandler)
+	for _, method := range []string{"PATCH", "OPTIONS"} {
+		r, _ := http.NewRequest(method, "/foo/bar", nil)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		isHTTPStatusOK(t, rw.Code)
+		if rw.Header().Get("X-Root") != "1" || rw.Header().Get("X-Box") != "1" {
+			t.Errorf("%s: expecting the middleware to be inherited got %v", method, rw.Header())
+		}
+	}
+}
+
+func TestBoxErrorHandler(t *testing.T) {
+	w := New()
+	sub := w.Box("/sub")
+	w.SetErrorHandler(func(ctx *Context, err error) {
+		ctx.Text(http.StatusInternalServerError, "app: "+err.Error())
+	})
+	fail := func(ctx *Context) error { return errors.New("oops") }
+	w.Get("/", fail)
+	sub.Get("/inherit", fail)
+
+	api := w.Box("/api")
+	api.SetErrorHandler(func(ctx *Context, err error) {
+		ctx.Text(http.StatusBadRequest, "api: "+err.Error())
+	})
+	api.Get("/", fail)
+
+	tests := []struct {
+		route string
+		code  int
+		body  string
+	}{
+		{"/", http.StatusInternalServerError, "app: oops"},
+		{"/sub/inherit", http.StatusInternalServerError, "app: oops"},
+		{"/api", http.StatusBadRequest, "api: oops"},
+	}
+	for _, test := range tests {
+		code, body := doRequest(t, "GET", test.route, nil, w)
+		if code != test.code || body != test.body {
+			t.Errorf("%s: expecting %d %s got %d %s", test.route, test.code, test.body, code, body)
+		}
+	}
+}
+
+func TestBoxNotFound(t *testing.T) {
+	w := New()
+	w.Get("/", noopHandler)
+	api := w.Box("/api")
+	api.Get("/users", noopHandler)
+	api.SetNotFound(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("api not found"))
+	}))
+	api.SetMethodNotAllowed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("api method not allowed"))
+	}))
+
+	_, body := doRequest(t, "GET", "/api/nope", nil, w)
+	if body != "api not found" {
+		t.Errorf("expecting body: api not found got %s", body)
+	}
+	_, body = doRequest(t, "POST", "/api/users", nil, w)
+	if body != "api method not allowed" {
+		t.Errorf("expecting body: api method not allowed got %s", body)
+	}
+	_, body = doRequest(t, "GET", "/apinope", nil, w)
+	if !strings.Contains(body, "404 page not found") {
+		t.Errorf("expecting body: 404 page not found got %s", body)
+	}
+	_, body = doRequest(t, "POST", "/", nil, w)
+	if !strings.Contains(body, "Method Not Allowed") {
+		t.Errorf("expecting body: Method Not Allowed got %s", body)
+	}
+}
+
+func TestBoxAPIMode(t *testing.T) {
+	w := New()
+	w.Get("/", noopHandler)
+	v1 := w.Box("/api/v1")
+	v1.SetAPIMode(true)
+	v1.Get("/users", func(ctx *Context) error {
+		return NewHTTPError(http.StatusForbidden, "not allowed")
+	})
+	v1.Box("/admin").Get("/", func(ctx *Context) error {
+		return errors.New("oops")
+	})
+
+	tests := []struct {
+		method, path string
+		code         int
+		contentType  string
+		body         string
+	}{
+		{"GET", "/api/v1/missing", http.StatusNotFound, "application/json", `{"error":{"code":404,"message":"Not Found"}}`},
+		{"POST", "/api/v1/users", http.StatusMethodNotAllowed, "application/json", `{"error":{"code":405,"message":"Method Not Allowed"}}`},
+		{"GET", "/api/v1/users", http.StatusForbidden, "application/json", `{"error":{"code":403,"message":"not allowed"}}`},
+		{"GET", "/api/v1/admin", http.StatusInternalServerError, "application/json", `{"error":{"code":500,"message":"oops"}}`},
+		{"GET", "/missing", http.StatusNotFound, "text/plain; charset=utf-8", "404 page not found"},
+		{"POST", "/", http.StatusMethodNotAllowed, "text/plain; charset=utf-8", "Method Not Allowed"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		body := strings.TrimSpace(rw.Body.String())
+		if rw.Code != test.code || rw.Header().Get("Content-Type") != test.contentType || body != test.body {
+			t.Errorf("%s %s: expecting %d %s %s got %d %s %s", test.method, test.path, test.code, test.contentType, test.body,
+				rw.Code, rw.Header().Get("Content-Type"), body)
+		}
+	}
+}
+
+func TestSetErrorFormat(t *testing.T) {
+	w := New()
+	w.SetErrorFormat(func(r *http.Request) Format {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			return FormatJSON
+		}
+		return FormatHTML
+	})
+	w.Get("/api/users", noopHandler)
+	w.Get("/fail", func(ctx *Context) error {
+		return NewHTTPError(http.StatusConflict, "<already exists>")
+	})
+	w.Box("/text").SetErrorFormat(func(r *http.Request) Format { return FormatText })
+
+	tests := []struct {
+		method      string
+		path        string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"GET", "/api/x", http.StatusNotFound, "application/json", `{"error":{"code":404,"message":"404 page not found"}}`},
+		{"POST", "/api/users", http.StatusMethodNotAllowed, "application/json", `"code":405`},
+		{"GET", "/x", http.StatusNotFound, "text/html; charset=utf-8", "<h1>404 Not Found</h1>"},
+		{"GET", "/fail", http.StatusConflict, "text/html; charset=utf-8", "<p>&lt;already exists&gt;</p>"},
+		{"GET", "/text/x", http.StatusNotFound, "text/plain; charset=utf-8", "404 page not found"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != test.code {
+			t.Errorf("%s %s: expecting code %d got %d", test.method, test.path, test.code, rw.Code)
+		}
+		if ct := rw.Header().Get("Content-Type"); ct != test.contentType {
+			t.Errorf("%s %s: expecting Content-Type %s got %s", test.method, test.path, test.contentType, ct)
+		}
+		if !strings.Contains(rw.Body.String(), test.body) {
+			t.Errorf("%s %s: expecting body to contain %s got %s", test.method, test.path, test.body, rw.Body.String())
+		}
+	}
+}
+
+func TestBoxTemplateEngine(t *testing.T) {
+	w := New()
+	sub := w.Box("/sub")
+	w.SetTemplateEngine(rowRenderer{})
+	sub.Get("/", func(ctx *Context) error {
+		return ctx.Render("table.html", 1)
+	})
+	code, body := doRequest(t, "GET", "/sub", nil, w)
+	isHTTPStatusOK(t, code)
+	if !strings.HasPrefix(body, "<tr>") {
+		t.Errorf("expecting the parents template engine to render got %s", body)
+	}
+}
+
 func TestStatic(t *testing.T) {
 	w := New()
 	w.Static("/public", "./")
@@ -93,6 +337,34 @@ func TestStatic(t *testing.T) {
 	}
 }
 
+func TestFavicon(t *testing.T) {
+	w := New()
+	w.Use(func(ctx *Context) error {
+		return errors.New("middleware should not run")
+	})
+	w.Favicon("./README.md")
+	code, body := doRequest(t, "GET", "/favicon.ico", nil, w)
+	isHTTPStatusOK(t, code)
+	if !strings.Contains(body, "weavebox") {
+		t.Error("expecting body containing string (weavebox)")
+	}
+}
+
+func TestRobotsTxt(t *testing.T) {
+	w := New()
+	w.RobotsTxt("User-agent: *")
+	r, _ := http.NewRequest("GET", "/robots.txt", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if rw.Body.String() != "User-agent: *" {
+		t.Errorf("expecting body (User-agent: *) got %s", rw.Body.String())
+	}
+	if ct := rw.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("expecting content type text/plain got %s", ct)
+	}
+}
+
 func TestContext(t *testing.T) {
 	w := New()
 	w.Get("/", checkContext(t, "m1", "m1"))
@@ -154,6 +426,26 @@ func TestBindContextSubrouter(t *testing.T) {
 	isHTTPStatusOK(t, code)
 }
 
+func TestContextSetGet(t *testing.T) {
+	const key ContextKey = "a"
+	w := New()
+	w.Use(func(ctx *Context) error {
+		ctx.Set(key, "b")
+		return nil
+	})
+	w.Get("/", func(ctx *Context) error {
+		if ctx.Get(key) != "b" {
+			t.Errorf("expected b got %v", ctx.Get(key))
+		}
+		if ctx.Context.Value("a") != nil {
+			t.Error("expected string key not to collide with ContextKey")
+		}
+		return nil
+	})
+	code, _ := doRequest(t, "GET", "/", nil, w)
+	isHTTPStatusOK(t, code)
+}
+
 func checkContext(t *testing.T, key, expect string) Handler {
 	return func(ctx *Context) error {
 		value := ctx.Context.Value(key).(string)
@@ -231,6 +523,47 @@ func TestBoxMiddlewareInheritsParent(t *testing.T) {
 	}
 }
 
+func TestRouteMiddleware(t *testing.T) {
+	buf := &bytes.Buffer{}
+	write := func(s string) Handler {
+		return func(ctx *Context) error {
+			buf.WriteString(s)
+			return nil
+		}
+	}
+	w := New()
+	w.Use(write("a"))
+	sub := w.Box("/sub")
+	sub.Use(write("b"))
+	sub.Get("/admin", write("h"), write("c"), write("d"))
+	sub.Get("/public", write("h"))
+	sub.Post("/admin", write("h"), func(ctx *Context) error {
+		return NewHTTPError(http.StatusUnauthorized)
+	})
+
+	code, _ := doRequest(t, "GET", "/sub/admin", nil, w)
+	isHTTPStatusOK(t, code)
+	if buf.String() != "abcdh" {
+		t.Errorf("expecting abcdh got %s", buf.String())
+	}
+
+	buf.Reset()
+	code, _ = doRequest(t, "GET", "/sub/public", nil, w)
+	isHTTPStatusOK(t, code)
+	if buf.String() != "abh" {
+		t.Errorf("expecting abh got %s", buf.String())
+	}
+
+	buf.Reset()
+	code, _ = doRequest(t, "POST", "/sub/admin", nil, w)
+	if code != http.StatusUnauthorized {
+		t.Errorf("expecting code 401 got %d", code)
+	}
+	if buf.String() != "ab" {
+		t.Errorf("expecting the route middleware to stop the chain got %s", buf.String())
+	}
+}
+
 func TestErrorHandler(t *testing.T) {
 	w := New()
 	errorMsg := "oops! something went wrong"
@@ -250,6 +583,148 @@ func TestErrorHandler(t *testing.T) {
 	}
 }
 
+func TestContextError(t *testing.T) {
+	w := New()
+	w.SetErrorHandler(func(ctx *Context, err error) {
+		t.Errorf("error handler should not be invoked, got %v", err)
+	})
+	w.Use(func(ctx *Context) error {
+		return ctx.Error(http.StatusForbidden, "access forbidden")
+	})
+	w.Get("/", func(ctx *Context) error {
+		t.Error("handler should not be invoked")
+		return nil
+	})
+	code, body := doRequest(t, "GET", "/", nil, w)
+	if code != http.StatusForbidden {
+		t.Errorf("expecting code 403 got %d", code)
+	}
+	if body != "access forbidden\n" {
+		t.Errorf("expecting body: access forbidden got %s", body)
+	}
+
+	w = New()
+	w.Get("/", func(ctx *Context) error {
+		ctx.Text(http.StatusOK, "ok")
+		return ctx.Error(http.StatusInternalServerError, "oops")
+	})
+	code, body = doRequest(t, "GET", "/", nil, w)
+	isHTTPStatusOK(t, code)
+	if body != "ok" {
+		t.Errorf("expecting body: ok got %s", body)
+	}
+}
+
+func TestContextSetStatus(t *testing.T) {
+	w := New()
+	w.Get("/", func(ctx *Context) error {
+		ctx.SetStatus(http.StatusAccepted)
+		ctx.Response().Header().Set("x-test", "test")
+		_, err := ctx.Response().Write([]byte("accepted"))
+		return err
+	})
+	w.Get("/empty", func(ctx *Context) error {
+		ctx.SetStatus(http.StatusNoContent)
+		return nil
+	})
+	w.Get("/override", func(ctx *Context) error {
+		ctx.SetStatus(http.StatusAccepted)
+		return ctx.Text(http.StatusCreated, "created")
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusAccepted {
+		t.Errorf("expecting code 202 got %d", rw.Code)
+	}
+	if rw.Header().Get("x-test") != "test" {
+		t.Error("expecting header x-test to be written")
+	}
+	if code, _ := doRequest(t, "GET", "/empty", nil, w); code != http.StatusNoContent {
+		t.Errorf("expecting code 204 got %d", code)
+	}
+	if code, _ := doRequest(t, "GET", "/override", nil, w); code != http.StatusCreated {
+		t.Errorf("expecting code 201 got %d", code)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := New()
+	w.Output = buf
+	w.EnableAccessLog = true
+	w.Get("/users/:id", func(ctx *Context) error {
+		if ctx.Route() != "/users/:id" {
+			t.Errorf("expecting route /users/:id got %s", ctx.Route())
+		}
+		if ctx.Param("id") == "9" {
+			return errors.New("record not found")
+		}
+		return nil
+	})
+
+	doRequest(t, "GET", "/users/1", nil, w)
+	if !strings.HasSuffix(buf.String(), "200 0 \"/users/:id\"\n") {
+		t.Errorf("expecting log line with route got %s", buf.String())
+	}
+	buf.Reset()
+	doRequest(t, "GET", "/users/9", nil, w)
+	if !strings.HasSuffix(buf.String(), "500 17 \"/users/:id\" \"record not found\"\n") {
+		t.Errorf("expecting log line with error got %s", buf.String())
+	}
+	buf.Reset()
+	doRequest(t, "GET", "/nope", nil, w)
+	if !strings.HasSuffix(buf.String(), "404 19 \"-\"\n") {
+		t.Errorf("expecting log line without route got %s", buf.String())
+	}
+}
+
+func TestAccessLogSampleRate(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := New()
+	w.Output = buf
+	w.EnableAccessLog = true
+	w.LogSampleRate = 0
+	w.Get("/", noopHandler)
+	w.Get("/error", func(ctx *Context) error {
+		return errors.New("oops")
+	})
+
+	for i := 0; i < 10; i++ {
+		doRequest(t, "GET", "/", nil, w)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expecting successful requests not to be logged got %s", buf.String())
+	}
+	doRequest(t, "GET", "/error", nil, w)
+	if !strings.Contains(buf.String(), " 500 ") {
+		t.Errorf("expecting errors to be logged got %s", buf.String())
+	}
+}
+
+func TestAccessLogPanic(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := New()
+	w.Output = buf
+	w.EnableAccessLog = true
+	w.Get("/", func(ctx *Context) error {
+		panic("oops")
+	})
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expecting the panic to continue")
+			}
+		}()
+		doRequest(t, "GET", "/", nil, w)
+	}()
+	if !strings.HasSuffix(buf.String(), "500 0 \"/\" \"panic: oops\"\n") {
+		t.Errorf("expecting log line with status 500 got %s", buf.String())
+	}
+}
+
 func TestWeaveboxHandler(t *testing.T) {
 	w := New()
 	handle := func(respStr string) Handler {
@@ -329,6 +804,283 @@ func TestSetMethodNotAllowed(t *testing.T) {
 	}
 }
 
+func TestMethodNotAllowedHandler(t *testing.T) {
+	w := New()
+	w.MethodNotAllowed(func(ctx *Context) error {
+		return ctx.JSON(http.StatusMethodNotAllowed, map[string][]string{
+			"allowed": ctx.AllowedMethods(),
+		})
+	})
+	w.Get("/users", noopHandler)
+	w.Post("/users", noopHandler)
+
+	code, body := doRequest(t, "DELETE", "/users", nil, w)
+	if code != http.StatusMethodNotAllowed {
+		t.Errorf("expecting code 405 got %d", code)
+	}
+	if !strings.Contains(body, `"GET"`) || !strings.Contains(body, `"POST"`) {
+		t.Errorf("expecting the allowed methods in the body got %s", body)
+	}
+
+	w.MethodNotAllowed(func(ctx *Context) error {
+		return NewHTTPError(http.StatusMethodNotAllowed, "use "+strings.Join(ctx.AllowedMethods(), " or "))
+	})
+	code, body = doRequest(t, "PUT", "/users", nil, w)
+	if code != http.StatusMethodNotAllowed {
+		t.Errorf("expecting code 405 got %d", code)
+	}
+	if !strings.HasPrefix(body, "use ") || !strings.Contains(body, "GET") {
+		t.Errorf("expecting the error to be handled by the ErrorHandler got %s", body)
+	}
+}
+
+func TestMaxURILength(t *testing.T) {
+	w := New()
+	w.MaxURILength = 16
+	w.Get("/:name", noopHandler)
+	code, _ := doRequest(t, "GET", "/anthony?a=b", nil, w)
+	isHTTPStatusOK(t, code)
+	code, body := doRequest(t, "GET", "/anthony?limit=25", nil, w)
+	if code != http.StatusRequestURITooLong {
+		t.Errorf("expecting code 414 got %d", code)
+	}
+	if !strings.Contains(body, "URI Too Long") {
+		t.Errorf("expecting body: URI Too Long got %s", body)
+	}
+}
+
+func TestStrictHost(t *testing.T) {
+	w := New()
+	w.Get("/", noopHandler)
+	tests := []struct {
+		strict bool
+		host   string
+		proto  int
+		code   int
+	}{
+		{false, "", 1, http.StatusOK},
+		{true, "", 1, http.StatusBadRequest},
+		{true, "example.com", 1, http.StatusOK},
+		{true, "", 0, http.StatusOK},
+	}
+	for _, test := range tests {
+		w.StrictHost = test.strict
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Host = test.host
+		r.ProtoMinor = test.proto
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != test.code {
+			t.Errorf("strict %t host %q HTTP/1.%d: expecting code %d got %d", test.strict, test.host, test.proto, test.code, rw.Code)
+		}
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	w := New()
+	w.StripPrefix("/service/")
+	w.Get("/", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, "root "+ctx.Request().URL.Path)
+	})
+	w.Get("/foo", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, "foo "+ctx.Request().URL.Path)
+	})
+	w.Box("/api").Get("/users/:id", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, "user "+ctx.Param("id"))
+	})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/service/foo", http.StatusOK, "foo /foo"},
+		{"/service", http.StatusOK, "root /"},
+		{"/service/", http.StatusOK, "root /"},
+		{"/service/api/users/1", http.StatusOK, "user 1"},
+		{"/foo", http.StatusNotFound, "404 page not found"},
+		{"/servicefoo", http.StatusNotFound, "404 page not found"},
+	}
+	for _, test := range tests {
+		code, body := doRequest(t, "GET", test.path, nil, w)
+		if code != test.code || strings.TrimSpace(body) != test.body {
+			t.Errorf("%s: expecting %d %s got %d %s", test.path, test.code, test.body, code, body)
+		}
+	}
+}
+
+func TestMaxConcurrentRequests(t *testing.T) {
+	w := New()
+	w.MaxConcurrentRequests = 1
+	var (
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	w.Get("/slow", func(ctx *Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	w.Get("/panic", func(ctx *Context) error {
+		panic("oops")
+	})
+	w.Get("/", noopHandler)
+
+	done := make(chan int)
+	go func() {
+		code, _ := doRequest(t, "GET", "/slow", nil, w)
+		done <- code
+	}()
+	<-started
+	r, _ := http.NewRequest("GET", "/", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusServiceUnavailable {
+		t.Errorf("expecting code 503 got %d", rw.Code)
+	}
+	if rw.Header().Get("Retry-After") == "" {
+		t.Error("expecting a Retry-After header")
+	}
+	close(release)
+	isHTTPStatusOK(t, <-done)
+
+	func() {
+		defer func() { recover() }()
+		doRequest(t, "GET", "/panic", nil, w)
+	}()
+	code, _ := doRequest(t, "GET", "/", nil, w)
+	isHTTPStatusOK(t, code)
+}
+
+func TestMalformedPath(t *testing.T) {
+	w := New()
+	w.Get("/:name", noopHandler)
+	for _, uri := range []string{"/%zz", "/foo%2", "/%zz?a=b"} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RequestURI = uri
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != http.StatusBadRequest {
+			t.Errorf("%s: expecting code 400 got %d", uri, rw.Code)
+		}
+	}
+	r, _ := http.NewRequest("GET", "/foo%20bar?q=%zz", nil)
+	r.RequestURI = "/foo%20bar?q=%zz"
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+}
+
+func TestAnyMethod(t *testing.T) {
+	w := New()
+	w.Get("/rpc", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, "get")
+	})
+	w.AnyMethod("/rpc", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, "any "+ctx.Request().Method)
+	})
+	b := w.Box("/api")
+	b.AnyMethod("/:name", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, "api "+ctx.Param("name"))
+	})
+	srv := httptest.NewServer(w)
+	defer srv.Close()
+
+	for _, test := range []struct {
+		method, path, body string
+	}{
+		{"GET", "/rpc", "get"},
+		{"POST", "/rpc", "any POST"},
+		{"DELETE", "/rpc", "any DELETE"},
+		{"PUT", "/api/foo", "api foo"},
+	} {
+		// the headers are read from a real response, a recorder reflects
+		// changes made after the header is written.
+		r, _ := http.NewRequest(test.method, srv.URL+test.path, nil)
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		isHTTPStatusOK(t, res.StatusCode)
+		if string(body) != test.body {
+			t.Errorf("%s %s: expecting body %q got %q", test.method, test.path, test.body, body)
+		}
+		if allow := res.Header.Get("Allow"); allow != "" {
+			t.Errorf("%s %s: expecting no Allow header got %q", test.method, test.path, allow)
+		}
+	}
+
+	r, _ := http.NewRequest("GET", "/other", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusNotFound {
+		t.Errorf("expecting code 404 got %d", rw.Code)
+	}
+}
+
+func TestOptionsPrecedence(t *testing.T) {
+	w := New()
+	w.SetMethodNotAllowed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	w.Get("/", noopHandler)
+	w.Options("/", func(ctx *Context) error {
+		return ctx.Text(http.StatusNoContent, "")
+	})
+	code, _ := doRequest(t, "OPTIONS", "/", nil, w)
+	if code != http.StatusNoContent {
+		t.Errorf("expecting code 204 got %d", code)
+	}
+}
+
+func TestSetGlobalOptions(t *testing.T) {
+	w := New()
+	w.SetMethodNotAllowed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	w.SetGlobalOptions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	w.Get("/foo", noopHandler)
+
+	r, _ := http.NewRequest("OPTIONS", "/foo", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusNoContent {
+		t.Errorf("expecting code 204 got %d", rw.Code)
+	}
+	if rw.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Error("expecting global options handler to be invoked")
+	}
+	if code, _ := doRequest(t, "POST", "/foo", nil, w); code != http.StatusMethodNotAllowed {
+		t.Errorf("expecting code 405 got %d", code)
+	}
+}
+
+func TestContextParamAt(t *testing.T) {
+	w := New()
+	w.Get("/:user/:repo", func(ctx *Context) error {
+		if ctx.ParamCount() != 2 {
+			t.Errorf("expecting 2 params got %d", ctx.ParamCount())
+		}
+		if name, value := ctx.ParamAt(1); name != "repo" || value != "weavebox" {
+			t.Errorf("expecting repo weavebox got %s %s", name, value)
+		}
+		if name, value := ctx.ParamAt(2); name != "" || value != "" {
+			t.Errorf("expecting empty param got %s %s", name, value)
+		}
+		if params := ctx.RouterParams(); len(params) != 2 || params.ByName("user") != "twanies" {
+			t.Errorf("expecting the router params got %v", params)
+		}
+		return nil
+	})
+	code, _ := doRequest(t, "GET", "/twanies/weavebox", nil, w)
+	isHTTPStatusOK(t, code)
+}
+
 func TestContextURLQuery(t *testing.T) {
 	req, _ := http.NewRequest("GET", "/?name=anthony", nil)
 	ctx := &Context{request: req}
@@ -357,6 +1109,330 @@ func TestContextHeader(t *testing.T) {
 	}
 }
 
+func TestContextCreated(t *testing.T) {
+	w := New()
+	w.Post("/users", func(ctx *Context) error {
+		return ctx.Created("/users/1", map[string]int{"id": 1})
+	})
+	r, _ := http.NewRequest("POST", "/users", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusCreated {
+		t.Errorf("expecting code 201 got %d", rw.Code)
+	}
+	if loc := rw.Header().Get("Location"); loc != "/users/1" {
+		t.Errorf("expecting location /users/1 got %s", loc)
+	}
+	if rw.Body.String() != "{\"id\":1}\n" {
+		t.Errorf("expecting the JSON body got %s", rw.Body.String())
+	}
+}
+
+// errorPages renders the error pages it holds, other templates fail to
+// render.
+type errorPages map[string]bool
+
+func (p errorPages) Render(w io.Writer, name string, data interface{}) error {
+	if !p[name] {
+		return errors.New("template not found: " + name)
+	}
+	e := data.(*HTTPError)
+	_, err := io.WriteString(w, name+": "+e.Message)
+	return err
+}
+
+func TestSetErrorTemplate(t *testing.T) {
+	w := New()
+	w.SetErrorTemplate(http.StatusNotFound, "errors/404.html")
+	w.SetErrorTemplate(http.StatusInternalServerError, "errors/500.html")
+	w.SetErrorTemplate(http.StatusConflict, "errors/missing.html")
+	w.Get("/fail", func(ctx *Context) error {
+		return errors.New("oops")
+	})
+	w.Get("/unavailable", func(ctx *Context) error {
+		return NewHTTPError(http.StatusServiceUnavailable)
+	})
+	w.Get("/conflict", func(ctx *Context) error {
+		return NewHTTPError(http.StatusConflict)
+	})
+	api := w.Box("/api")
+	api.SetAPIMode(true)
+	api.Get("/fail", func(ctx *Context) error {
+		return errors.New("oops")
+	})
+
+	expect := func(path string, code int, body string) {
+		c, b := doRequest(t, "GET", path, nil, w)
+		if c != code {
+			t.Errorf("%s: expecting code %d got %d", path, code, c)
+		}
+		if !strings.Contains(b, body) {
+			t.Errorf("%s: expecting body %q got %q", path, body, b)
+		}
+	}
+	// without a template engine the errors are written as text.
+	expect("/missing", http.StatusNotFound, "404 page not found")
+	expect("/fail", http.StatusInternalServerError, "oops")
+
+	w.SetTemplateEngine(errorPages{"errors/404.html": true, "errors/500.html": true})
+	expect("/missing", http.StatusNotFound, "errors/404.html: 404 page not found")
+	expect("/fail", http.StatusInternalServerError, "errors/500.html: oops")
+	expect("/unavailable", http.StatusServiceUnavailable, "errors/500.html: Service Unavailable")
+	expect("/conflict", http.StatusConflict, "Conflict")
+	expect("/api/fail", http.StatusInternalServerError, `{"error":{"code":500,"message":"oops"}}`)
+}
+
+func TestContextHTML(t *testing.T) {
+	w := New()
+	w.Get("/", func(ctx *Context) error {
+		return ctx.HTML(http.StatusCreated, "<p>hello</p>")
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusCreated {
+		t.Errorf("expecting code 201 got %d", rw.Code)
+	}
+	if ct := rw.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("expecting Content-Type text/html got %s", ct)
+	}
+	if rw.Body.String() != "<p>hello</p>" {
+		t.Errorf("expecting <p>hello</p> got %s", rw.Body.String())
+	}
+}
+
+func TestContextXML(t *testing.T) {
+	type user struct {
+		XMLName xml.Name `xml:"user"`
+		Name    string   `xml:"name"`
+	}
+	w := New()
+	w.Get("/", func(ctx *Context) error {
+		return ctx.XML(http.StatusOK, user{Name: "anthony"})
+	})
+	w.Get("/pretty", func(ctx *Context) error {
+		return ctx.XMLPretty(http.StatusOK, user{Name: "anthony"})
+	})
+	w.Get("/invalid", func(ctx *Context) error {
+		return ctx.XML(http.StatusOK, make(chan int))
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if ct := rw.Header().Get("Content-Type"); ct != "application/xml" {
+		t.Errorf("expecting Content-Type application/xml got %s", ct)
+	}
+	if body := rw.Body.String(); body != "<user><name>anthony</name></user>" {
+		t.Errorf("expecting XML got %s", body)
+	}
+
+	w.XMLHeader = true
+	_, body := doRequest(t, "GET", "/pretty", nil, w)
+	if expected := xml.Header + "<user>\n  <name>anthony</name>\n</user>"; body != expected {
+		t.Errorf("expecting indented XML with a declaration got %q", body)
+	}
+
+	var handled error
+	w.SetErrorHandler(func(ctx *Context, err error) { handled = err })
+	doRequest(t, "GET", "/invalid", nil, w)
+	if handled == nil {
+		t.Error("expecting the encoding error to be passed to the ErrorHandler")
+	}
+}
+
+func TestContextRenderAbort(t *testing.T) {
+	w := New()
+	w.SetTemplateEngine(errorPages{"errors/forbidden.html": true})
+	handled := false
+	w.SetErrorHandler(func(ctx *Context, err error) {
+		handled = true
+		ctx.Text(http.StatusInternalServerError, err.Error())
+	})
+	w.Use(func(ctx *Context) error {
+		if ctx.Query("abort") != "" {
+			return ctx.RenderAbort(http.StatusForbidden, ctx.Query("abort"), NewHTTPError(http.StatusForbidden, "no access"))
+		}
+		return nil
+	})
+	w.Get("/", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, "handler")
+	})
+
+	code, body := doRequest(t, "GET", "/?abort=errors/forbidden.html", nil, w)
+	if code != http.StatusForbidden {
+		t.Errorf("expecting code 403 got %d", code)
+	}
+	if body != "errors/forbidden.html: no access" {
+		t.Errorf("expecting the rendered template got %s", body)
+	}
+	if handled {
+		t.Error("expecting the ErrorHandler not to be invoked")
+	}
+
+	code, body = doRequest(t, "GET", "/?abort=errors/missing.html", nil, w)
+	if code != http.StatusInternalServerError || !strings.Contains(body, "template not found") {
+		t.Errorf("expecting the render error to be handled got %d %s", code, body)
+	}
+}
+
+func TestResponseNewlineAndIndent(t *testing.T) {
+	w := New()
+	w.Get("/text", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, "hello")
+	})
+	w.Get("/json", func(ctx *Context) error {
+		return ctx.JSON(http.StatusOK, map[string]int{"a": 1})
+	})
+
+	_, body := doRequest(t, "GET", "/text", nil, w)
+	if body != "hello" {
+		t.Errorf("expecting the text as is got %q", body)
+	}
+	_, body = doRequest(t, "GET", "/json", nil, w)
+	if body != "{\"a\":1}\n" {
+		t.Errorf("expecting compact JSON with a newline got %q", body)
+	}
+
+	w.TextNewline = true
+	w.JSONIndent = "  "
+	_, body = doRequest(t, "GET", "/text", nil, w)
+	if body != "hello\n" {
+		t.Errorf("expecting a trailing newline got %q", body)
+	}
+	_, body = doRequest(t, "GET", "/json", nil, w)
+	if body != "{\n  \"a\": 1\n}\n" {
+		t.Errorf("expecting indented JSON got %q", body)
+	}
+
+	w.RegisterEncoder("application/json", func(rw io.Writer, v interface{}) error {
+		_, err := io.WriteString(rw, "custom")
+		return err
+	})
+	_, body = doRequest(t, "GET", "/json", nil, w)
+	if body != "custom" {
+		t.Errorf("expecting the registered encoder to be used got %q", body)
+	}
+}
+
+func TestContextQueryValues(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/?tag=a&tag=b&page=2", nil)
+	ctx := NewTestContext(httptest.NewRecorder(), r)
+	query := ctx.QueryValues()
+	if len(query["tag"]) != 2 || query.Get("page") != "2" {
+		t.Errorf("expecting tag=a&tag=b&page=2 got %v", query)
+	}
+	r.URL.RawQuery = "page=3"
+	if ctx.QueryValues().Get("page") != "2" || ctx.Query("page") != "2" {
+		t.Error("expecting the query to be parsed once")
+	}
+}
+
+func TestContextInput(t *testing.T) {
+	tests := []struct {
+		target, body, expected string
+	}{
+		{"/?q=query", "", "query"},
+		{"/", "q=form", "form"},
+		{"/?q=query", "q=form", "query"},
+		{"/?q=", "q=form", "form"},
+		{"/", "", ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("POST", test.target, strings.NewReader(test.body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		ctx := NewTestContext(httptest.NewRecorder(), r)
+		if v := ctx.Input("q"); v != test.expected {
+			t.Errorf("%s %s: expecting %q got %q", test.target, test.body, test.expected, v)
+		}
+	}
+}
+
+func TestContextCookies(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/", nil)
+	ctx := NewTestContext(httptest.NewRecorder(), r)
+	if cookies := ctx.Cookies(); cookies == nil || len(cookies) != 0 {
+		t.Errorf("expecting an empty map got %v", cookies)
+	}
+
+	r.Header.Set("Cookie", "session=abc; flash=saved; session=def")
+	cookies := ctx.Cookies()
+	if len(cookies) != 2 || cookies["session"] != "abc" || cookies["flash"] != "saved" {
+		t.Errorf("expecting session=abc and flash=saved got %v", cookies)
+	}
+}
+
+func TestContextCookie(t *testing.T) {
+	w := New()
+	w.Get("/", func(ctx *Context) error {
+		if _, err := ctx.Cookie("missing"); err != http.ErrNoCookie {
+			t.Errorf("expecting http.ErrNoCookie got %v", err)
+		}
+		session, err := ctx.Cookie("session")
+		if err != nil {
+			return err
+		}
+		ctx.SetCookie(&http.Cookie{Name: "theme", Value: "dark"})
+		ctx.SetCookieValue("session", session.Value+"2", 3600)
+		ctx.SetCookieValue("flash", "", -1)
+		return nil
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", "session=abc")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+
+	expected := []string{
+		"theme=dark",
+		"session=abc2; Path=/; Max-Age=3600; HttpOnly; SameSite=Lax",
+		"flash=; Path=/; Max-Age=0; HttpOnly; SameSite=Lax",
+	}
+	cookies := rw.Header()["Set-Cookie"]
+	if len(cookies) != len(expected) {
+		t.Fatalf("expecting %d cookies got %v", len(expected), cookies)
+	}
+	for i, cookie := range cookies {
+		if cookie != expected[i] {
+			t.Errorf("expecting cookie %s got %s", expected[i], cookie)
+		}
+	}
+
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", "session=abc")
+	r.TLS = &tls.ConnectionState{}
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if cookie := rw.Header()["Set-Cookie"][1]; !strings.Contains(cookie, "; Secure") {
+		t.Errorf("expecting a Secure cookie over HTTPS got %s", cookie)
+	}
+}
+
+func TestContextBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		token  string
+		ok     bool
+	}{
+		{"Bearer abc.def", "abc.def", true},
+		{"bearer  abc ", "abc", true},
+		{"Basic YWxhZGRpbjpvcGVuc2VzYW1l", "", false},
+		{"Bearer ", "", false},
+		{"Bearer a b", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", test.header)
+		ctx := &Context{request: req}
+		token, ok := ctx.BearerToken()
+		if token != test.token || ok != test.ok {
+			t.Errorf("%q: expected (%s, %v) got (%s, %v)", test.header, test.token, test.ok, token, ok)
+		}
+	}
+}
+
 func isHTTPStatusOK(t *testing.T, code int) {
 	if code != http.StatusOK {
 		t.Errorf("Expecting status 200 got %d", code)
@@ -372,3 +1448,70 @@ func doRequest(t *testing.T, method, route string, body io.Reader, w *Weavebox)
 	w.ServeHTTP(rw, r)
 	return rw.Code, rw.Body.String()
 }
+
+func TestContextReuse(t *testing.T) {
+	w := New()
+	w.Get("/:name", func(ctx *Context) error {
+		if ctx.Get("name") != nil {
+			t.Error("expecting the values of a previous request to be reset")
+		}
+		if len(ctx.QueryValues()) > 0 && ctx.Query("v") != ctx.Param("name") {
+			t.Errorf("expecting query %s got %s", ctx.Param("name"), ctx.Query("v"))
+		}
+		ctx.Set("name", ctx.Param("name"))
+		return ctx.Text(http.StatusOK, ctx.Param("name"))
+	})
+
+	for _, name := range []string{"foo", "bar", "baz"} {
+		r, _ := http.NewRequest("GET", "/"+name+"?v="+name, nil)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Body.String() != name {
+			t.Errorf("expecting body %s got %s", name, rw.Body.String())
+		}
+	}
+}
+
+func TestContextSeq(t *testing.T) {
+	w := New()
+	w.Box("/api").Get("/", func(ctx *Context) error {
+		return ctx.Text(http.StatusOK, strconv.FormatUint(ctx.Seq(), 10))
+	})
+	for _, expected := range []string{"1", "2", "3"} {
+		_, body := doRequest(t, "GET", "/api", nil, w)
+		if body != expected {
+			t.Errorf("expecting sequence number %s got %s", expected, body)
+		}
+	}
+}
+
+func TestContextUser(t *testing.T) {
+	type user struct{ name string }
+	w := New()
+	w.Use(func(ctx *Context) error {
+		if token, ok := ctx.BearerToken(); ok {
+			ctx.SetUser(&user{name: token})
+		}
+		return nil
+	})
+	w.Get("/", func(ctx *Context) error {
+		u, ok := ctx.User().(*user)
+		if !ok {
+			return ctx.Text(http.StatusUnauthorized, "anonymous")
+		}
+		return ctx.Text(http.StatusOK, u.name)
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer anthony")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Body.String() != "anthony" {
+		t.Errorf("expecting the user set by the middleware got %s", rw.Body.String())
+	}
+
+	code, _ := doRequest(t, "GET", "/", nil, w)
+	if code != http.StatusUnauthorized {
+		t.Errorf("expecting no user for the next request got %d", code)
+	}
+}